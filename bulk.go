@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/heckdevice/moxy/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"time"
+)
+
+// Statuses of the items of a bulk registration
+const (
+	// bulkRegistered - The API got registered
+	bulkRegistered = "registered"
+	// bulkFailed - The API is invalid or clashes with a registered one, nothing got registered
+	bulkFailed = "failed"
+	// bulkNotRegistered - The API is fine but some other item failed, nothing got registered
+	bulkNotRegistered = "not_registered"
+)
+
+// BulkItemResult - Outcome of a single API of a bulk registration
+type BulkItemResult struct {
+	Index  int    `json:"index"`
+	APIURL string `json:"api_url"`
+	Method string `json:"method"`
+	APIID  string `json:"api_id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkReport - Outcome of a bulk registration, all the APIs got registered if committed and none otherwise
+type BulkReport struct {
+	Committed bool             `json:"committed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// bulkItem - An API of a bulk registration resolved to what it is to be registered with
+type bulkItem struct {
+	req         *MockableRequest
+	verb        core.Verb
+	reqAsserted core.Payload
+	mockedResp  *core.MockedResponse
+	expiresAt   *time.Time
+}
+
+// fail - Marks the item failed, the items not failed yet are left not registered
+func (report *BulkReport) fail(index int, err error) {
+	report.Results[index].Status = bulkFailed
+	report.Results[index].Error = err.Error()
+}
+
+// apiBulkRegistration - Registers an array of APIs (same payload as apiRegistration) in one go, all or nothing
+// Every API is validated and checked against the registered ones and the others of the array, each getting a result in the report.
+// Responds 200 if all got registered and 422 if none did
+func apiBulkRegistration(ctx *fasthttp.RequestCtx) {
+	var reqs []MockableRequest
+	err := json.Unmarshal(ctx.Request.Body(), &reqs)
+	if err != nil {
+		handleBadRequest(ctx, "Unable to parse request payload, expected an array of APIs")
+		return
+	}
+	service, err := getServiceFromCtx(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	report := &BulkReport{Results: make([]BulkItemResult, len(reqs))}
+	items := make([]bulkItem, len(reqs))
+	failed := false
+	for i := range reqs {
+		req := &reqs[i]
+		report.Results[i] = BulkItemResult{Index: i, APIURL: req.APIURL, Method: req.Method, Status: bulkNotRegistered}
+		item := bulkItem{req: req}
+		err := validate.Struct(req)
+		if err == nil {
+			item.verb, item.reqAsserted, item.mockedResp, err = req.resolve()
+		}
+		if err == nil {
+			item.expiresAt, err = resolveExpiry(req.TTL, req.ExpiresAt)
+		}
+		if err != nil {
+			report.fail(i, err)
+			failed = true
+			continue
+		}
+		items[i] = item
+	}
+	// The valid items are registered even if some already failed, so that modes and clashes get reported for all of them,
+	// the change is then dropped
+	err = updateStore(ctx, func(tx *core.Tx) error {
+		for i, item := range items {
+			req := item.req
+			if req == nil {
+				continue
+			}
+			api, err := tx.RegisterProfileAPI(service.ID, req.Profile, req.APIURL, req.Matchers, item.verb, item.reqAsserted, item.mockedResp, req.InvocationMode)
+			if err == nil {
+				report.Results[i].APIID = api.ID
+				err = req.configure(tx, service.ID, api.ID, item.expiresAt)
+			}
+			if err != nil {
+				report.fail(i, err)
+				failed = true
+			}
+		}
+		if failed {
+			return fmt.Errorf("Bulk registration rejected")
+		}
+		return nil
+	})
+	if err != nil && !failed {
+		handleError(ctx, err)
+		return
+	}
+	if failed {
+		writeError(ctx, fasthttp.StatusUnprocessableEntity, bulkRejectedCode, err.Error(), report)
+		return
+	}
+	report.Committed = true
+	for i := range report.Results {
+		report.Results[i].Status = bulkRegistered
+	}
+	if len(items) > 0 {
+		registerServiceRoute(service.ID)
+	}
+	log.Info(fmt.Sprintf("Bulk registered %v APIs for service %v", len(items), service.ID))
+	writeJSONResponse(ctx, report, nil)
+}
@@ -0,0 +1,112 @@
+package core
+
+import "time"
+
+// changesKept - Change events kept for the subscribers resuming after a disconnect, the oldest are dropped first
+const changesKept = 1000
+
+// subscriberBuffer - Change events a subscriber may lag behind before it gets dropped
+const subscriberBuffer = 256
+
+// ChangeEvent - A service or API created, updated, deleted or expired, along with its state right after the change (none once removed)
+// Events are numbered in the order they got published starting at 1, numbering starts over when the registry gets created
+type ChangeEvent struct {
+	ID        uint64    `json:"id"`
+	Change    string    `json:"change"`
+	Timestamp time.Time `json:"timestamp"`
+	ServiceID string    `json:"service_id"`
+	// APIID - Empty for service level changes
+	APIID   string `json:"api_id,omitempty"`
+	Author  string `json:"author,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	// Service - State of the service, its APIs have change events of their own and are hence left out
+	Service *ServiceRecord `json:"service,omitempty"`
+	API     *API           `json:"api,omitempty"`
+}
+
+// changeFeed - Change events recently published by a registry and its subscribers, guarded by the registry writeLock
+type changeFeed struct {
+	lastID       uint64
+	recent       []ChangeEvent
+	subscribers  map[int]chan ChangeEvent
+	subscriberID int
+}
+
+// Subscription - Change events published to a subscriber
+type Subscription struct {
+	// Backlog - Changes published after the one resumed from and still kept, oldest first
+	Backlog []ChangeEvent
+	// Gap - Some of the changes published after the one resumed from are no longer kept, or got published by a previous run
+	Gap bool
+	// Events - Upcoming changes, closed once the subscription is closed or if the subscriber lags too far behind
+	Events <-chan ChangeEvent
+	close  func()
+}
+
+// Close - Stops the subscription, safe to call more than once
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// publishChanges - Numbers the changes of the published change and hands them to the subscribers,
+// a subscriber lagging too far behind is dropped and expected to resume from the last change it got
+func (r *Registry) publishChanges(tx *Tx) {
+	now := time.Now().UTC()
+	for _, pending := range tx.revisions {
+		revision := pending.revision
+		revision.revisionState(pending.key, tx.services)
+		r.changes.lastID++
+		event := ChangeEvent{r.changes.lastID, revision.Change, now, pending.key.serviceID, pending.key.apiID, tx.author, tx.comment, revision.Service, revision.API}
+		r.changes.recent = append(r.changes.recent, event)
+		if len(r.changes.recent) > changesKept {
+			r.changes.recent = append([]ChangeEvent(nil), r.changes.recent[len(r.changes.recent)-changesKept:]...)
+		}
+		for subscriberID, events := range r.changes.subscribers {
+			select {
+			case events <- event:
+			default:
+				close(events)
+				delete(r.changes.subscribers, subscriberID)
+			}
+		}
+	}
+}
+
+// Subscribe - Subscribes to the changes published after the one with id afterID, 0 for the upcoming changes only
+func (r *Registry) Subscribe(afterID uint64) *Subscription {
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+	subscription := &Subscription{}
+	if afterID > r.changes.lastID {
+		// Resuming from a change of a previous run, all of the changes of this run are new to the subscriber
+		subscription.Gap = true
+		afterID = 0
+	}
+	if afterID > 0 {
+		for _, event := range r.changes.recent {
+			if event.ID > afterID {
+				subscription.Backlog = append(subscription.Backlog, event)
+			}
+		}
+		subscription.Gap = afterID < r.changes.lastID && (len(subscription.Backlog) == 0 || subscription.Backlog[0].ID > afterID+1)
+	} else if subscription.Gap {
+		subscription.Backlog = append([]ChangeEvent(nil), r.changes.recent...)
+	}
+	if r.changes.subscribers == nil {
+		r.changes.subscribers = make(map[int]chan ChangeEvent)
+	}
+	r.changes.subscriberID++
+	subscriberID := r.changes.subscriberID
+	events := make(chan ChangeEvent, subscriberBuffer)
+	r.changes.subscribers[subscriberID] = events
+	subscription.Events = events
+	subscription.close = func() {
+		r.writeLock.Lock()
+		defer r.writeLock.Unlock()
+		if events, OK := r.changes.subscribers[subscriberID]; OK {
+			close(events)
+			delete(r.changes.subscribers, subscriberID)
+		}
+	}
+	return subscription
+}
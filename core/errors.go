@@ -0,0 +1,40 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of the errors returned by core, match them with errors.Is
+var (
+	// ErrNotFound - The service, API or revision is not registered
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyRegistered - A service or API with the same id is already registered
+	ErrAlreadyRegistered = errors.New("already registered")
+	// ErrInvalidMode - The invocation mode is unknown or not allowed for the service
+	ErrInvalidMode = errors.New("invalid mode")
+	// ErrUnsupportedVerb - The HTTP method can not be mocked
+	ErrUnsupportedVerb = errors.New("unsupported verb")
+	// ErrInvalidArgument - A name, label, selector or other value is malformed
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
+// Error - An error of one of the well known kinds, its message is left as is
+type Error struct {
+	kind    error
+	message string
+}
+
+// NewError - Creates an error of the given kind, errors.Is(err, kind) holds for it
+func NewError(kind error, format string, args ...interface{}) error {
+	return &Error{kind, fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Unwrap - Kind of the error
+func (e *Error) Unwrap() error {
+	return e.kind
+}
@@ -0,0 +1,71 @@
+package core
+
+import "time"
+
+func expired(expiresAt *time.Time, now time.Time) bool {
+	return expiresAt != nil && !now.Before(*expiresAt)
+}
+
+// IsExpired - Checks if the time to live of the service elapsed by now
+func (s *Service) IsExpired(now time.Time) bool {
+	return expired(s.ExpiresAt, now)
+}
+
+// IsExpired - Checks if the time to live of the API elapsed by now
+func (api *API) IsExpired(now time.Time) bool {
+	return expired(api.ExpiresAt, now)
+}
+
+// changed - Checks if the service (empty apiID) or API already changed within the pending change
+func (tx *Tx) changed(serviceID, apiID string) bool {
+	for _, event := range tx.events {
+		if event.ServiceID == serviceID && event.APIID == apiID {
+			return true
+		}
+	}
+	return false
+}
+
+// SetServiceExpiry - Sets when the service along with its APIs is to be removed within the pending change, nil never expires it
+func (tx *Tx) SetServiceExpiry(serviceID string, expiresAt *time.Time) error {
+	_, err := tx.replaceService(serviceID, func(service *Service) bool {
+		if service.ExpiresAt == nil && expiresAt == nil {
+			return false
+		}
+		service.ExpiresAt = expiresAt
+		return true
+	})
+	return err
+}
+
+// SetAPIExpiry - Sets when the API is to be removed within the pending change, nil never expires it
+func (tx *Tx) SetAPIExpiry(serviceID, apiID string, expiresAt *time.Time) error {
+	_, err := tx.replaceAPI(serviceID, apiID, func(api *API) bool {
+		if api.ExpiresAt == nil && expiresAt == nil {
+			return false
+		}
+		api.ExpiresAt = expiresAt
+		return true
+	})
+	return err
+}
+
+// Expire - Removes the services and APIs whose time to live elapsed by now within the pending change,
+// reports how many services and APIs were removed
+func (tx *Tx) Expire(now time.Time) (int, int) {
+	services, apis := 0, 0
+	for serviceID, service := range tx.services {
+		if service.IsExpired(now) {
+			tx.unregisterService(serviceID, ServiceExpired)
+			services++
+			continue
+		}
+		for apiID, api := range service.registeredAPIs {
+			if api.IsExpired(now) {
+				tx.unregisterAPI(serviceID, apiID, APIExpired)
+				apis++
+			}
+		}
+	}
+	return services, apis
+}
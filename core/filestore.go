@@ -0,0 +1,38 @@
+package core
+
+import "fmt"
+
+// FileStore - Store keeping the registry in memory and persisting every change to a snapshot file
+// The file is rewritten atomically on each change and loaded back when the store is created
+type FileStore struct {
+	*Registry
+	path string
+}
+
+// NewFileStore - Creates a file backed store, loading the services and APIs already persisted at path (if any)
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("File store needs a file path")
+	}
+	store := &FileStore{NewRegistry(), path}
+	snapshot, err := LoadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		if err := store.Restore(snapshot); err != nil {
+			return nil, fmt.Errorf("Unable to load store file %v :: %v", path, err.Error())
+		}
+	}
+	store.Registry.persist = store.save
+	return store, nil
+}
+
+// Path - File the store persists to
+func (fs *FileStore) Path() string {
+	return fs.path
+}
+
+func (fs *FileStore) save(services map[string]*Service) error {
+	return SaveSnapshot(fs.path, newSnapshot(services))
+}
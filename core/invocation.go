@@ -0,0 +1,68 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// invocationCounter - Requests served by an API, shared by all the copies of the API so that it survives updates
+type invocationCounter struct {
+	served int64
+}
+
+// Invoke - Counts a request served by the API, reports false without counting it once the API served all its times
+func (api *API) Invoke() bool {
+	if api.invocations == nil {
+		return true
+	}
+	for {
+		served := atomic.LoadInt64(&api.invocations.served)
+		if api.Times != nil && served >= int64(*api.Times) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&api.invocations.served, served, served+1) {
+			return true
+		}
+	}
+}
+
+// serves - Whether the API is still to serve requests by now, i.e. it neither expired nor served all its times
+func (api *API) serves(now time.Time) bool {
+	if api.IsExpired(now) {
+		return false
+	}
+	remaining := api.Remaining()
+	return remaining == nil || *remaining > 0
+}
+
+// Remaining - Requests the API is still to serve, nil if not limited
+func (api *API) Remaining() *int {
+	if api.Times == nil {
+		return nil
+	}
+	remaining := *api.Times
+	if api.invocations != nil {
+		remaining -= int(atomic.LoadInt64(&api.invocations.served))
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// SetAPITimes - Limits the API to serve the given number of requests within the pending change, nil serves unlimited requests
+// The requests already served are forgotten
+func (tx *Tx) SetAPITimes(serviceID, apiID string, times *int) error {
+	if times != nil && *times < 1 {
+		return NewError(ErrInvalidArgument, "times should be at least 1")
+	}
+	_, err := tx.replaceAPI(serviceID, apiID, func(api *API) bool {
+		if api.Times == nil && times == nil {
+			return false
+		}
+		api.Times = times
+		api.invocations = &invocationCounter{}
+		return true
+	})
+	return err
+}
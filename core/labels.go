@@ -0,0 +1,151 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Labels - Free-form key value pairs tagging a service or API, e.g. team=payments
+type Labels map[string]string
+
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+	labelValuePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+)
+
+// Validate - Checks the label keys are made of letters, digits, '_', '.', '/' and '-' and the values of the same but '/'
+func (labels Labels) Validate() error {
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return NewError(ErrInvalidArgument, "Invalid label key %q", key)
+		}
+		if !labelValuePattern.MatchString(value) {
+			return NewError(ErrInvalidArgument, "Invalid value %q of label %v", value, key)
+		}
+	}
+	return nil
+}
+
+// Label selector operators
+const (
+	labelEquals    = "="
+	labelNotEquals = "!="
+	labelExists    = "exists"
+	labelAbsent    = "!exists"
+)
+
+// labelRequirement - A single term of a label selector
+type labelRequirement struct {
+	key      string
+	operator string
+	value    string
+}
+
+func (req labelRequirement) matches(labels Labels) bool {
+	value, OK := labels[req.key]
+	switch req.operator {
+	case labelEquals:
+		return OK && value == req.value
+	case labelNotEquals:
+		return !OK || value != req.value
+	case labelExists:
+		return OK
+	default:
+		return !OK
+	}
+}
+
+// LabelSelector - Comma separated requirements all the labels have to meet, an empty selector matches everything
+// Requirements are key=value (or key==value), key!=value, key (has the label) and !key (does not have the label)
+type LabelSelector []labelRequirement
+
+// ParseLabelSelector - Parses a selector such as team=payments,suite!=smoke,!temporary
+func ParseLabelSelector(selector string) (LabelSelector, error) {
+	var parsed LabelSelector
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		var req labelRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			req = labelRequirement{strings.TrimSpace(parts[0]), labelNotEquals, strings.TrimSpace(parts[1])}
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(strings.Replace(term, "==", "=", 1), "=", 2)
+			req = labelRequirement{strings.TrimSpace(parts[0]), labelEquals, strings.TrimSpace(parts[1])}
+		case strings.HasPrefix(term, "!"):
+			req = labelRequirement{strings.TrimSpace(term[1:]), labelAbsent, ""}
+		default:
+			req = labelRequirement{term, labelExists, ""}
+		}
+		if !labelKeyPattern.MatchString(req.key) || !labelValuePattern.MatchString(req.value) {
+			return nil, NewError(ErrInvalidArgument, "Invalid label selector term %q", term)
+		}
+		parsed = append(parsed, req)
+	}
+	return parsed, nil
+}
+
+// Matches - Checks the labels meet all the requirements of the selector
+func (selector LabelSelector) Matches(labels Labels) bool {
+	for _, req := range selector {
+		if !req.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetServiceLabels - Replaces the labels of the service within the pending change
+func (tx *Tx) SetServiceLabels(serviceID string, labels Labels) error {
+	if err := labels.Validate(); err != nil {
+		return err
+	}
+	_, err := tx.replaceService(serviceID, func(service *Service) bool {
+		if len(service.Labels) == 0 && len(labels) == 0 {
+			return false
+		}
+		service.Labels = labels
+		return true
+	})
+	return err
+}
+
+// SetAPILabels - Replaces the labels of the API within the pending change
+func (tx *Tx) SetAPILabels(serviceID, apiID string, labels Labels) error {
+	if err := labels.Validate(); err != nil {
+		return err
+	}
+	_, err := tx.replaceAPI(serviceID, apiID, func(api *API) bool {
+		if len(api.Labels) == 0 && len(labels) == 0 {
+			return false
+		}
+		api.Labels = labels
+		return true
+	})
+	return err
+}
+
+// SelectServices - Picks the services whose labels match the selector out of the given ones
+func SelectServices(services map[string]*Service, selector LabelSelector) map[string]*Service {
+	selected := make(map[string]*Service)
+	for serviceID, service := range services {
+		if selector.Matches(service.Labels) {
+			selected[serviceID] = service
+		}
+	}
+	return selected
+}
+
+// SelectAPIs - Picks the APIs whose labels match the selector out of the given ones
+func SelectAPIs(apis map[string]*API, selector LabelSelector) map[string]*API {
+	selected := make(map[string]*API)
+	for apiID, api := range apis {
+		if selector.Matches(api.Labels) {
+			selected[apiID] = api
+		}
+	}
+	return selected
+}
@@ -0,0 +1,316 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	json "encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// APIRequest - The parts of a mock request APIs get matched against
+type APIRequest struct {
+	// URL - Requested url relative to the service, along with its query
+	URL     string
+	Verb    Verb
+	Payload Payload
+	// Headers - Request headers by name, in any case
+	Headers map[string][]string
+	Cookies map[string]string
+	// query - Params of the query of the url
+	query url.Values
+	// headers - Request headers by lower case name
+	headers map[string][]string
+	// now - Time the request is matched at, the APIs expired or done serving by then are skipped
+	now time.Time
+}
+
+// RequestMatchers - Conditions on the request an API serves on top of its url, verb and payload
+type RequestMatchers struct {
+	Query *QueryMatchers `json:"query,omitempty"`
+	// Headers - Matchers by header name, names are case insensitive and headers without a matcher are ignored
+	Headers map[string]*ValueMatcher `json:"headers,omitempty"`
+	// Cookies - Matchers by cookie name, cookies without a matcher are ignored
+	Cookies map[string]*ValueMatcher `json:"cookies,omitempty"`
+}
+
+// ValueMatcher - Condition on the values of a request element (e.g. a query param), only one of its fields is set
+type ValueMatcher struct {
+	Equals   *string `json:"equals,omitempty"`
+	Contains *string `json:"contains,omitempty"`
+	Present  bool    `json:"present,omitempty"`
+	Absent   bool    `json:"absent,omitempty"`
+	Regex    string  `json:"regex,omitempty"`
+	regex    *regexp.Regexp
+}
+
+// compile - Validated copy of the matcher with its regular expression compiled
+func (m *ValueMatcher) compile() (*ValueMatcher, error) {
+	if m == nil {
+		return nil, fmt.Errorf("one of equals, contains, present, absent or regex is needed")
+	}
+	set := 0
+	for _, isSet := range []bool{m.Equals != nil, m.Contains != nil, m.Present, m.Absent, m.Regex != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of equals, contains, present, absent or regex is needed")
+	}
+	compiled := *m
+	if m.Regex != "" {
+		regex, err := regexp.Compile(m.Regex)
+		if err != nil {
+			return nil, err
+		}
+		compiled.regex = regex
+	}
+	return &compiled, nil
+}
+
+// matches - Whether any of the values satisfies the matcher, none given means the element is absent from the request
+func (m *ValueMatcher) matches(values []string) bool {
+	switch {
+	case m.Absent:
+		return len(values) == 0
+	case m.Present:
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if (m.Equals != nil && value == *m.Equals) || (m.Contains != nil && strings.Contains(value, *m.Contains)) ||
+			(m.regex != nil && m.regex.MatchString(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// compile - Validated copy of the matchers for an API registered with the given url, nil if there are no matchers
+func (m *RequestMatchers) compile(url string) (*RequestMatchers, error) {
+	if m == nil || (m.Query == nil && len(m.Headers) == 0 && len(m.Cookies) == 0) {
+		return nil, nil
+	}
+	compiled := &RequestMatchers{}
+	if m.Query != nil {
+		if _, query := splitQuery(url); query != "" && !IsURLPattern(url) {
+			return nil, NewError(ErrInvalidArgument, "api_url %v has a query, query params are matched either by the api_url or by the query matchers", url)
+		}
+		query, err := m.Query.compile()
+		if err != nil {
+			return nil, err
+		}
+		compiled.Query = query
+	}
+	var err error
+	if compiled.Headers, err = compileValueMatchers("header", m.Headers, strings.ToLower); err != nil {
+		return nil, err
+	}
+	if compiled.Cookies, err = compileValueMatchers("cookie", m.Cookies, nil); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// compileValueMatchers - Validated copy of the matchers of the named request elements, keyed by normalized name (if normalize is set)
+func compileValueMatchers(kind string, matchers map[string]*ValueMatcher, normalize func(string) string) (map[string]*ValueMatcher, error) {
+	if len(matchers) == 0 {
+		return nil, nil
+	}
+	compiled := make(map[string]*ValueMatcher, len(matchers))
+	for name, matcher := range matchers {
+		key := name
+		if normalize != nil {
+			key = normalize(name)
+		}
+		if _, OK := compiled[key]; OK {
+			return nil, NewError(ErrInvalidArgument, "The %v %v has more than one matcher, %v names are case insensitive", kind, name, kind)
+		}
+		valueMatcher, err := matcher.compile()
+		if err != nil {
+			return nil, NewError(ErrInvalidArgument, "Invalid matcher of %v %v :: %v", kind, name, err.Error())
+		}
+		compiled[key] = valueMatcher
+	}
+	return compiled, nil
+}
+
+// matches - Whether the request satisfies the matchers
+func (m *RequestMatchers) matches(req *APIRequest) bool {
+	if m.Query != nil && !m.Query.matches(req.query) {
+		return false
+	}
+	for name, matcher := range m.Headers {
+		if !matcher.matches(req.headers[name]) {
+			return false
+		}
+	}
+	for name, matcher := range m.Cookies {
+		var values []string
+		if value, OK := req.Cookies[name]; OK {
+			values = []string{value}
+		}
+		if !matcher.matches(values) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameMatchers - Whether both are the same conditions on the request, none being the same as none only
+func sameMatchers(a, b *RequestMatchers) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	first, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	second, err := json.Marshal(b)
+	return err == nil && string(first) == string(second)
+}
+
+// MatchersAPIID - Id of the API with the given id and matchers, APIs with different matchers may share url, verb and payload
+func MatchersAPIID(apiID string, matchers *RequestMatchers) (string, error) {
+	if matchers == nil {
+		return apiID, nil
+	}
+	seed, err := json.Marshal(matchers)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(apiID + " " + string(seed)))
+	return hex.EncodeToString(sum[0:]), nil
+}
+
+// RegistrationID - Id of the API registered with the given profile, url, matchers, verb and payload
+func RegistrationID(profile, url string, matchers *RequestMatchers, verb Verb, payload Payload) (string, error) {
+	routeID, _, err := GenerateAPIID(url, verb, payload)
+	if err != nil {
+		return "", fmt.Errorf("Error generating API ID :: %v", err.Error())
+	}
+	compiled, err := matchers.compile(url)
+	if err != nil {
+		return "", err
+	}
+	apiID, err := MatchersAPIID(*routeID, compiled)
+	if err != nil {
+		return "", err
+	}
+	return ProfileAPIID(apiID, profile), nil
+}
+
+// APIMatch - The API serving a request along with the parameters captured out of the requested url
+type APIMatch struct {
+	API    *API
+	Params map[string]string
+}
+
+// apiMatcher - A stage of the API resolution, returns nil if none of the APIs of the service match at this stage
+type apiMatcher func(s *Service, req *APIRequest) (*APIMatch, error)
+
+// apiMatchers - Stages of the API resolution in order, the first match wins
+var apiMatchers = []apiMatcher{matchExactAPI, matchTemplateAPI, matchPatternAPI}
+
+// registeredAPI - The API serving the request among the ones registered with the given url, nil if none.
+// The ones with matchers come first, only those matching on the query are considered unless queryMatched (the query of the url is the requested one)
+func (s *Service) registeredAPI(url string, req *APIRequest, queryMatched bool) (*API, error) {
+	routeID, _, err := GenerateAPIID(url, req.Verb, req.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if api := s.matchingAPI(*routeID, req, queryMatched); api != nil {
+		return api, nil
+	}
+	if !queryMatched {
+		return nil, nil
+	}
+	return s.servingAPI(*routeID, req.now), nil
+}
+
+// matchingAPI - The API with matchers registered for the route whose matchers the request satisfies and still serving,
+// the ones of the active profile first and then the earliest registered
+func (s *Service) matchingAPI(routeID string, req *APIRequest, queryMatched bool) *API {
+	var found *API
+	for _, api := range s.registeredAPIs {
+		if api.Matchers == nil || api.routeID != routeID || (!queryMatched && api.Matchers.Query == nil) {
+			continue
+		}
+		if api.Profile != DefaultProfile && api.Profile != s.ActiveProfile || !api.serves(req.now) || !api.Matchers.matches(req) {
+			continue
+		}
+		if found == nil || (api.Profile != found.Profile && api.Profile != DefaultProfile) ||
+			(api.Profile == found.Profile && (api.CreatedAt.Before(found.CreatedAt) || api.CreatedAt.Equal(found.CreatedAt) && api.ID < found.ID)) {
+			found = api
+		}
+	}
+	return found
+}
+
+// matchExactAPI - Matches the request against the APIs registered with the very same url, verb and payload,
+// the ones registered with the requested path and matching on the query coming right after the ones with other matchers
+func matchExactAPI(s *Service, req *APIRequest) (*APIMatch, error) {
+	routeID, _, err := GenerateAPIID(req.URL, req.Verb, req.Payload)
+	if err != nil {
+		return nil, err
+	}
+	api := s.matchingAPI(*routeID, req, true)
+	if path, query := splitQuery(req.URL); api == nil && query != "" {
+		pathRouteID, _, err := GenerateAPIID(path, req.Verb, req.Payload)
+		if err != nil {
+			return nil, err
+		}
+		api = s.matchingAPI(*pathRouteID, req, false)
+	}
+	if api == nil {
+		if api = s.servingAPI(*routeID, req.now); api == nil {
+			return nil, nil
+		}
+	}
+	return &APIMatch{api, nil}, nil
+}
+
+// MatchAPI - Resolves the API of the service serving the request, errs if none does
+// Within each stage the APIs with matchers the request satisfies take precedence over the ones without.
+// An API registered with the exact url takes precedence over the ones registered with a path template, which take precedence over
+// the ones registered with a regular expression. The APIs expired or done serving their times are skipped as if unregistered
+func (s *Service) MatchAPI(req *APIRequest) (*APIMatch, error) {
+	canonical := *req
+	canonical.now = time.Now()
+	canonical.URL = canonicalURL(req.URL)
+	_, query := splitQuery(canonical.URL)
+	canonical.query, _ = url.ParseQuery(query)
+	canonical.headers = make(map[string][]string, len(req.Headers))
+	for name, values := range req.Headers {
+		headerName := strings.ToLower(name)
+		canonical.headers[headerName] = append(canonical.headers[headerName], values...)
+	}
+	req = &canonical
+	for _, matcher := range apiMatchers {
+		match, err := matcher(s, req)
+		if err != nil {
+			return nil, err
+		}
+		if match != nil {
+			return match, nil
+		}
+	}
+	return nil, NewError(ErrNotFound, "No API of service with id=%v matches %v %v", s.ID, req.Verb, req.URL)
+}
+
+// ServeAPI - Resolves the API serving the request as MatchAPI does and counts the request against its times.
+// An API serving its last time to a concurrent request in between is skipped and the resolution starts over
+func (s *Service) ServeAPI(req *APIRequest) (*APIMatch, error) {
+	for {
+		match, err := s.MatchAPI(req)
+		if err != nil {
+			return nil, err
+		}
+		if match.API.Invoke() {
+			return match, nil
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// registration - An API registered for a matching case, answering with its body
+type registration struct {
+	profile   string
+	url       string
+	matchers  *RequestMatchers
+	expiresAt *time.Time
+	times     *int
+	body      string
+}
+
+func equals(value string) *ValueMatcher {
+	return &ValueMatcher{Equals: &value}
+}
+
+// matchService - Registers the APIs on a service with the given active profile
+func matchService(t *testing.T, apis []registration, activeProfile string) *Service {
+	registry := NewRegistry()
+	var serviceID string
+	err := registry.Update(func(tx *Tx) error {
+		service, err := tx.RegisterService(DefaultNamespace, "matching", "1", nil, nil)
+		if err != nil {
+			return err
+		}
+		serviceID = service.ID
+		for _, registration := range apis {
+			api, err := tx.RegisterProfileAPI(service.ID, registration.profile, registration.url, registration.matchers, GET, Payload{}, mockedResponse(registration.body), nil)
+			if err != nil {
+				return err
+			}
+			if err := tx.SetAPIExpiry(service.ID, api.ID, registration.expiresAt); err != nil {
+				return err
+			}
+			if err := tx.SetAPITimes(service.ID, api.ID, registration.times); err != nil {
+				return err
+			}
+		}
+		_, err = tx.SetActiveProfile(service.ID, activeProfile)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unable to register APIs :: %v", err)
+	}
+	service, err := registry.GetServiceByID(serviceID)
+	if err != nil {
+		t.Fatalf("Service lookup failed :: %v", err)
+	}
+	return service
+}
+
+func TestMatchAPIPrecedence(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	cases := []struct {
+		name          string
+		apis          []registration
+		activeProfile string
+		req           APIRequest
+		// body - Body of the API expected to serve, none if no API is to match
+		body   string
+		params map[string]string
+	}{
+		{
+			name: "literal over template",
+			apis: []registration{{url: "/users/{id}", body: "template"}, {url: "/users/1", body: "literal"}},
+			req:  APIRequest{URL: "/users/1"},
+			body: "literal",
+		},
+		{
+			name:   "template when no literal matches",
+			apis:   []registration{{url: "/users/{id}", body: "template"}, {url: "/users/1", body: "literal"}},
+			req:    APIRequest{URL: "/users/2"},
+			body:   "template",
+			params: map[string]string{"id": "2"},
+		},
+		{
+			name:   "template over regex",
+			apis:   []registration{{url: "^/users/[0-9]+$", body: "regex"}, {url: "/users/{id}", body: "template"}},
+			req:    APIRequest{URL: "/users/7"},
+			body:   "template",
+			params: map[string]string{"id": "7"},
+		},
+		{
+			name:   "regex with named groups",
+			apis:   []registration{{url: "^/users/(?P<id>[0-9]+)$", body: "regex"}},
+			req:    APIRequest{URL: "/users/7?verbose=1"},
+			body:   "regex",
+			params: map[string]string{"id": "7"},
+		},
+		{
+			name:   "first literal segment wins between templates",
+			apis:   []registration{{url: "/{type}/{id}", body: "generic"}, {url: "/users/{id}", body: "users"}},
+			req:    APIRequest{URL: "/users/7"},
+			body:   "users",
+			params: map[string]string{"id": "7"},
+		},
+		{
+			name:          "active profile over untagged",
+			apis:          []registration{{url: "/a", body: "untagged"}, {profile: "outage", url: "/a", body: "outage"}},
+			activeProfile: "outage",
+			req:           APIRequest{URL: "/a"},
+			body:          "outage",
+		},
+		{
+			name: "inactive profile ignored",
+			apis: []registration{{url: "/a", body: "untagged"}, {profile: "outage", url: "/a", body: "outage"}},
+			req:  APIRequest{URL: "/a"},
+			body: "untagged",
+		},
+		{
+			name:          "expired profile API falls through to untagged",
+			apis:          []registration{{url: "/a", body: "untagged"}, {profile: "outage", url: "/a", expiresAt: &expired, body: "outage"}},
+			activeProfile: "outage",
+			req:           APIRequest{URL: "/a"},
+			body:          "untagged",
+		},
+		{
+			name: "expired API not matched",
+			apis: []registration{{url: "/a", expiresAt: &expired, body: "expired"}},
+			req:  APIRequest{URL: "/a"},
+		},
+		{
+			name: "matchers over none",
+			apis: []registration{
+				{url: "/a", body: "plain"},
+				{url: "/a", matchers: &RequestMatchers{Headers: map[string]*ValueMatcher{"X-Env": equals("ci")}}, body: "ci"},
+			},
+			req:  APIRequest{URL: "/a", Headers: map[string][]string{"X-Env": {"ci"}}},
+			body: "ci",
+		},
+		{
+			name: "unsatisfied matchers fall back to none",
+			apis: []registration{
+				{url: "/a", body: "plain"},
+				{url: "/a", matchers: &RequestMatchers{Headers: map[string]*ValueMatcher{"X-Env": equals("ci")}}, body: "ci"},
+			},
+			req:  APIRequest{URL: "/a", Headers: map[string][]string{"X-Env": {"prod"}}},
+			body: "plain",
+		},
+		{
+			name: "matchers over template",
+			apis: []registration{
+				{url: "/users/{id}", matchers: &RequestMatchers{Headers: map[string]*ValueMatcher{"X-Env": equals("ci")}}, body: "ci"},
+				{url: "/users/{id}", body: "plain"},
+			},
+			req:    APIRequest{URL: "/users/3", Headers: map[string][]string{"X-Env": {"ci"}}},
+			body:   "ci",
+			params: map[string]string{"id": "3"},
+		},
+		{
+			name: "header names case insensitive",
+			apis: []registration{{url: "/a", matchers: &RequestMatchers{Headers: map[string]*ValueMatcher{"X-Env": equals("ci")}}, body: "ci"}},
+			req:  APIRequest{URL: "/a", Headers: map[string][]string{"x-ENV": {"ci"}}},
+			body: "ci",
+		},
+		{
+			name: "header values case sensitive",
+			apis: []registration{{url: "/a", matchers: &RequestMatchers{Headers: map[string]*ValueMatcher{"X-Env": equals("ci")}}, body: "ci"}},
+			req:  APIRequest{URL: "/a", Headers: map[string][]string{"X-Env": {"CI"}}},
+		},
+		{
+			name: "cookie names case sensitive",
+			apis: []registration{
+				{url: "/a", body: "plain"},
+				{url: "/a", matchers: &RequestMatchers{Cookies: map[string]*ValueMatcher{"Session": {Present: true}}}, body: "session"},
+			},
+			req:  APIRequest{URL: "/a", Cookies: map[string]string{"session": "1"}},
+			body: "plain",
+		},
+		{
+			name: "cookie matched",
+			apis: []registration{
+				{url: "/a", body: "plain"},
+				{url: "/a", matchers: &RequestMatchers{Cookies: map[string]*ValueMatcher{"Session": {Present: true}}}, body: "session"},
+			},
+			req:  APIRequest{URL: "/a", Cookies: map[string]string{"Session": "1"}},
+			body: "session",
+		},
+		{
+			name: "query matchers over template",
+			apis: []registration{
+				{url: "/users/{id}", matchers: &RequestMatchers{Query: &QueryMatchers{Params: map[string]*ValueMatcher{"env": equals("ci")}}}, body: "ci"},
+				{url: "/users/{id}", body: "plain"},
+			},
+			req:    APIRequest{URL: "/users/3?env=ci"},
+			body:   "ci",
+			params: map[string]string{"id": "3"},
+		},
+		{
+			name: "query order insensitive",
+			apis: []registration{{url: "/q?b=2&a=1", body: "query"}},
+			req:  APIRequest{URL: "/q?a=1&b=2"},
+			body: "query",
+		},
+		{
+			name: "repeated query params order insensitive",
+			apis: []registration{{url: "/q?a=2&a=1", body: "query"}},
+			req:  APIRequest{URL: "/q?a=1&a=2"},
+			body: "query",
+		},
+		{
+			name: "query values compared",
+			apis: []registration{{url: "/q?a=1", body: "query"}},
+			req:  APIRequest{URL: "/q?a=2"},
+		},
+		{
+			name: "query matchers over the query of the url",
+			apis: []registration{
+				{url: "/q", matchers: &RequestMatchers{Query: &QueryMatchers{Params: map[string]*ValueMatcher{"a": {Present: true}}}}, body: "matchers"},
+				{url: "/q?a=1", body: "query"},
+			},
+			req:  APIRequest{URL: "/q?a=1"},
+			body: "matchers",
+		},
+		{
+			name: "query of the url when query matchers unsatisfied",
+			apis: []registration{
+				{url: "/q", matchers: &RequestMatchers{Query: &QueryMatchers{Params: map[string]*ValueMatcher{"a": equals("2")}}}, body: "matchers"},
+				{url: "/q?a=1", body: "query"},
+			},
+			req:  APIRequest{URL: "/q?a=1"},
+			body: "query",
+		},
+		{
+			name: "other query params rejected unless ignored",
+			apis: []registration{
+				{url: "/q", matchers: &RequestMatchers{Query: &QueryMatchers{Params: map[string]*ValueMatcher{"a": {Present: true}}}}, body: "matchers"},
+			},
+			req: APIRequest{URL: "/q?a=2&b=1"},
+		},
+		{
+			name: "other query params ignored",
+			apis: []registration{
+				{url: "/q", matchers: &RequestMatchers{Query: &QueryMatchers{Params: map[string]*ValueMatcher{"a": {Present: true}}, IgnoreOthers: true}}, body: "matchers"},
+			},
+			req:  APIRequest{URL: "/q?b=1&a=2"},
+			body: "matchers",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service := matchService(t, c.apis, c.activeProfile)
+			req := c.req
+			req.Verb, req.Payload = GET, Payload{}
+			match, err := service.MatchAPI(&req)
+			if c.body == "" {
+				if err == nil {
+					t.Fatalf("Expected no API to match, matched %v", match.API.APIResponse.ResponsePayload["body"])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected %v to match :: %v", c.body, err)
+			}
+			if body := match.API.APIResponse.ResponsePayload["body"]; body != c.body {
+				t.Fatalf("Expected %v to match, matched %v", c.body, body)
+			}
+			if len(match.Params) != 0 || len(c.params) != 0 {
+				if !reflect.DeepEqual(match.Params, c.params) {
+					t.Fatalf("Expected params %v, captured %v", c.params, match.Params)
+				}
+			}
+		})
+	}
+}
+
+func TestServeAPIFallsThroughSpentAPI(t *testing.T) {
+	once := 1
+	service := matchService(t, []registration{{url: "/a", body: "untagged"}, {profile: "outage", url: "/a", times: &once, body: "outage"}}, "outage")
+	for _, expected := range []string{"outage", "untagged", "untagged"} {
+		match, err := service.ServeAPI(&APIRequest{URL: "/a", Verb: GET, Payload: Payload{}})
+		if err != nil {
+			t.Fatalf("Expected %v to serve :: %v", expected, err)
+		}
+		if body := match.API.APIResponse.ResponsePayload["body"]; body != expected {
+			t.Fatalf("Expected %v to serve, served %v", expected, body)
+		}
+	}
+}
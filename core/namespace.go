@@ -0,0 +1,74 @@
+package core
+
+import "regexp"
+
+// DefaultNamespace - Namespace of the services registered without one, their ids carry no namespace prefix
+const DefaultNamespace = ""
+
+// namespaceIDPrefix - Prefix of the ids (and hence of the mock urls) of the services registered within a namespace
+const namespaceIDPrefix = "ns/"
+
+// namePattern - Names of namespaces and profiles
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidateNamespace - Checks the namespace is made of letters, digits, '-' and '_' only
+func ValidateNamespace(namespace string) error {
+	if namespace != DefaultNamespace && !namePattern.MatchString(namespace) {
+		return NewError(ErrInvalidArgument, "Invalid namespace %v, only letters, digits, '-' and '_' are allowed", namespace)
+	}
+	return nil
+}
+
+// NamespacedServiceID - Full id of the service within the namespace, ns/{namespace}/{serviceID} unless in the default namespace
+func NamespacedServiceID(namespace, serviceID string) string {
+	if namespace == DefaultNamespace {
+		return serviceID
+	}
+	return namespaceIDPrefix + namespace + "/" + serviceID
+}
+
+// NamespaceServices - Picks the services of the namespace out of the given ones
+func NamespaceServices(services map[string]*Service, namespace string) map[string]*Service {
+	namespaceServices := make(map[string]*Service)
+	for serviceID, service := range services {
+		if service.Namespace == namespace {
+			namespaceServices[serviceID] = service
+		}
+	}
+	return namespaceServices
+}
+
+// GetNamespaces - Counts the services registered within each of the namespaces in use, default namespace excluded
+func GetNamespaces(services map[string]*Service) map[string]int {
+	namespaces := make(map[string]int)
+	for _, service := range services {
+		if service.Namespace != DefaultNamespace {
+			namespaces[service.Namespace]++
+		}
+	}
+	return namespaces
+}
+
+// Reset - Removes the services of every namespace matching the selector along with their APIs within the pending change,
+// reports how many were removed
+func (tx *Tx) Reset(selector LabelSelector) int {
+	removed := 0
+	for serviceID, service := range tx.services {
+		if selector.Matches(service.Labels) && tx.UnregisterService(serviceID) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// ResetNamespace - Removes the services of the namespace matching the selector along with their APIs within the pending change,
+// reports how many were removed
+func (tx *Tx) ResetNamespace(namespace string, selector LabelSelector) int {
+	removed := 0
+	for serviceID, service := range tx.services {
+		if service.Namespace == namespace && selector.Matches(service.Labels) && tx.UnregisterService(serviceID) {
+			removed++
+		}
+	}
+	return removed
+}
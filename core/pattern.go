@@ -0,0 +1,75 @@
+package core
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// urlPatternPrefix - API urls starting with it are regular expressions matched against the requested path, e.g. ^/v[12]/items/[0-9a-f]{24}$
+const urlPatternPrefix = "^"
+
+// IsURLPattern - Whether the API url is a regular expression
+func IsURLPattern(url string) bool {
+	return strings.HasPrefix(url, urlPatternPrefix)
+}
+
+// compileURLPattern - Compiles the API url as a regular expression, nil if it is not one
+func compileURLPattern(url string) (*regexp.Regexp, error) {
+	if !IsURLPattern(url) {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(url)
+	if err != nil {
+		return nil, NewError(ErrInvalidArgument, "Invalid api_url regular expression %v :: %v", url, err.Error())
+	}
+	return pattern, nil
+}
+
+// matchPatternAPI - Matches the requested path (query excluded) against the APIs registered with a regular expression,
+// the earliest registered first. Named groups are captured as parameters
+func matchPatternAPI(s *Service, req *APIRequest) (*APIMatch, error) {
+	patterns := make(map[string]*API)
+	for _, api := range s.registeredAPIs {
+		if api.pattern == nil || api.APIVerb != req.Verb {
+			continue
+		}
+		if earliest, OK := patterns[api.URL]; !OK || api.CreatedAt.Before(earliest.CreatedAt) {
+			patterns[api.URL] = api
+		}
+	}
+	urls := make([]string, 0, len(patterns))
+	for patternURL := range patterns {
+		urls = append(urls, patternURL)
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		first, second := patterns[urls[i]], patterns[urls[j]]
+		if !first.CreatedAt.Equal(second.CreatedAt) {
+			return first.CreatedAt.Before(second.CreatedAt)
+		}
+		return urls[i] < urls[j]
+	})
+	path, _ := splitQuery(req.URL)
+	for _, patternURL := range urls {
+		pattern := patterns[patternURL].pattern
+		groups := pattern.FindStringSubmatch(path)
+		if groups == nil {
+			continue
+		}
+		api, err := s.registeredAPI(patternURL, req, true)
+		if err != nil {
+			return nil, err
+		}
+		if api == nil {
+			continue
+		}
+		params := make(map[string]string)
+		for i, name := range pattern.SubexpNames() {
+			if name != "" && i < len(groups) {
+				params[name] = groups[i]
+			}
+		}
+		return &APIMatch{api, params}, nil
+	}
+	return nil, nil
+}
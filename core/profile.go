@@ -0,0 +1,55 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// DefaultProfile - Profile of the untagged APIs, they serve whichever profile is active unless the profile overrides them
+const DefaultProfile = ""
+
+// ValidateProfile - Checks the profile is made of letters, digits, '-' and '_' only
+func ValidateProfile(profile string) error {
+	if profile != DefaultProfile && !namePattern.MatchString(profile) {
+		return NewError(ErrInvalidArgument, "Invalid profile %v, only letters, digits, '-' and '_' are allowed", profile)
+	}
+	return nil
+}
+
+// ProfileAPIID - Id of the API with the given id within the profile, APIs of different profiles may share url, verb and payload
+func ProfileAPIID(apiID, profile string) string {
+	if profile == DefaultProfile {
+		return apiID
+	}
+	sum := sha256.Sum256([]byte(profile + " " + apiID))
+	return hex.EncodeToString(sum[0:])
+}
+
+// servingAPI - The API still serving the api id by now, the one of the active profile if it serves else the untagged one, nil if none
+func (s *Service) servingAPI(apiID string, now time.Time) *API {
+	if s.ActiveProfile != DefaultProfile {
+		if api, OK := s.registeredAPIs[ProfileAPIID(apiID, s.ActiveProfile)]; OK && api.serves(now) {
+			return api
+		}
+	}
+	if api, OK := s.registeredAPIs[apiID]; OK && api.serves(now) {
+		return api
+	}
+	return nil
+}
+
+// SetActiveProfile - Switches the profile the service resolves its APIs against within the pending change,
+// the default profile leaves the untagged APIs only
+func (tx *Tx) SetActiveProfile(serviceID, profile string) (*Service, error) {
+	if err := ValidateProfile(profile); err != nil {
+		return nil, err
+	}
+	return tx.replaceService(serviceID, func(service *Service) bool {
+		if service.ActiveProfile == profile {
+			return false
+		}
+		service.ActiveProfile = profile
+		return true
+	})
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"fmt"
+	"github.com/valyala/fasthttp"
+	proxy "github.com/yeqown/fasthttp-reverse-proxy/v2"
+	"sync"
+)
+
+// ServiceProxy - Reverse proxy to the actual service, safe to close while requests are being proxied through it
+type ServiceProxy struct {
+	lock  sync.RWMutex
+	proxy *proxy.ReverseProxy
+}
+
+// NewServiceProxy - Creates the reverse proxy to the service base url
+func NewServiceProxy(baseURL string) *ServiceProxy {
+	return &ServiceProxy{proxy: proxy.NewReverseProxy(baseURL)}
+}
+
+// ServeHTTP - Proxies the request to the actual service, errs if the proxy is closed
+func (sp *ServiceProxy) ServeHTTP(ctx *fasthttp.RequestCtx) error {
+	sp.lock.RLock()
+	defer sp.lock.RUnlock()
+	if sp.proxy == nil {
+		return fmt.Errorf("Service reverse proxy is closed")
+	}
+	sp.proxy.ServeHTTP(ctx)
+	return nil
+}
+
+// Close - Waits for the requests being proxied to complete and releases the proxy
+func (sp *ServiceProxy) Close() {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+	if sp.proxy != nil {
+		sp.proxy.Close()
+		sp.proxy = nil
+	}
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"net/url"
+	"sort"
+)
+
+// canonicalURL - The url with its query params sorted by name and value, so that the order they are given in does not matter
+// Regular expression urls and urls with an unparsable query are left as they are
+func canonicalURL(rawURL string) string {
+	if IsURLPattern(rawURL) {
+		return rawURL
+	}
+	path, query := splitQuery(rawURL)
+	if query == "" {
+		return path
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return rawURL
+	}
+	for _, paramValues := range values {
+		sort.Strings(paramValues)
+	}
+	return path + "?" + values.Encode()
+}
+
+// QueryMatchers - Conditions on the query params of the request, matched instead of the query of the api_url
+type QueryMatchers struct {
+	Params map[string]*ValueMatcher `json:"params,omitempty"`
+	// IgnoreOthers - Params without a matcher are ignored, else a request carrying any of them does not match
+	IgnoreOthers bool `json:"ignore_others,omitempty"`
+}
+
+// compile - Validated copy of the matchers with their regular expressions compiled
+func (m *QueryMatchers) compile() (*QueryMatchers, error) {
+	compiled := &QueryMatchers{make(map[string]*ValueMatcher, len(m.Params)), m.IgnoreOthers}
+	for name, matcher := range m.Params {
+		valueMatcher, err := matcher.compile()
+		if err != nil {
+			return nil, NewError(ErrInvalidArgument, "Invalid matcher of query param %v :: %v", name, err.Error())
+		}
+		compiled.Params[name] = valueMatcher
+	}
+	return compiled, nil
+}
+
+// matches - Whether the query params satisfy the matchers
+func (m *QueryMatchers) matches(query url.Values) bool {
+	for name, matcher := range m.Params {
+		if !matcher.matches(query[name]) {
+			return false
+		}
+	}
+	if !m.IgnoreOthers {
+		for name := range query {
+			if _, OK := m.Params[name]; !OK {
+				return false
+			}
+		}
+	}
+	return true
+}
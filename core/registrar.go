@@ -5,7 +5,8 @@ import (
 	"encoding/hex"
 	json "encoding/json"
 	"fmt"
-	proxy "github.com/yeqown/fasthttp-reverse-proxy/v2"
+	"regexp"
+	"time"
 )
 
 // Verb - Represent the HTTP Verb enum type
@@ -31,10 +32,18 @@ type Service struct {
 	ID             string `json:"id,omitempty"`
 	Name           string `json:"name" validate:"required"`
 	Version        string `json:"version" validate:"required"`
+	Namespace      string `json:"namespace,omitempty"`
 	registeredAPIs map[string]*API
 	BaseURL        *string `json:"base_url,omitempty"`
 	InvocationMode *string `json:"invocation_mode,omitempty" default:"mock"`
-	ReverseProxy   *proxy.ReverseProxy
+	// ExpiresAt - When the service along with its APIs is to be removed, never if nil
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ActiveProfile - Profile the mocked requests are resolved against on top of the untagged APIs
+	ActiveProfile string `json:"active_profile,omitempty"`
+	Labels        Labels `json:"labels,omitempty"`
+	// CreatedAt - When the service got registered
+	CreatedAt    time.Time `json:"created_at"`
+	ReverseProxy *ServiceProxy
 }
 
 // API - Configure a mock api giving the URL and the http verb supported for the URL
@@ -48,6 +57,24 @@ type API struct {
 	APIResponse    *MockedResponse `json:"api_response"`
 	SelfURL        string          `json:"self_url"`
 	InvocationMode *string         `json:"invocation_mode" default:"mock"`
+	// ExpiresAt - When the API is to be removed, never if nil
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Times - How many requests the API serves before being treated as unregistered, unlimited if nil
+	Times *int `json:"times,omitempty"`
+	// Profile - Profile the API serves in, untagged APIs serve in all profiles
+	Profile string `json:"profile,omitempty"`
+	// Matchers - Conditions on the request on top of url, verb and payload, none if nil
+	Matchers *RequestMatchers `json:"matchers,omitempty"`
+	Labels   Labels           `json:"labels,omitempty"`
+	// CreatedAt - When the API got registered
+	CreatedAt   time.Time `json:"created_at"`
+	invocations *invocationCounter
+	// template - Parameters of the url, nil unless the url is a path template
+	template *pathTemplate
+	// pattern - Compiled url, nil unless the url is a regular expression
+	pattern *regexp.Regexp
+	// routeID - Id of the url, verb and payload the API gets looked up by, matchers and profile left out
+	routeID string
 }
 
 // IDSeeds - Various elements that seed the API Id generation hash
@@ -75,7 +102,15 @@ const (
 )
 
 // String - string valueof the Verb enum
-func (v Verb) String() string { return verbs[v] }
+func (v Verb) String() string {
+	if !v.IsValid() {
+		return fmt.Sprintf("Verb(%d)", int(v))
+	}
+	return verbs[v]
+}
+
+// IsValid - Whether the Verb is one of the supported HTTP methods
+func (v Verb) IsValid() bool { return v >= GET && v <= PUT }
 
 // ResolveVerb - Resolves HTTP method string to moxy Verb
 func ResolveVerb(httpMethod string) (Verb, error) {
@@ -89,13 +124,12 @@ func ResolveVerb(httpMethod string) (Verb, error) {
 	case "PUT":
 		return PUT, nil
 	default:
-		return -1, fmt.Errorf("HTTP Method %v not supported", httpMethod)
+		return -1, NewError(ErrUnsupportedVerb, "HTTP Method %v not supported", httpMethod)
 	}
 }
 
 var (
-	registeredServices = make(map[string]*Service)
-	verbs              = [...]string{
+	verbs = [...]string{
 		"GET",
 		"POST",
 		"DELETE",
@@ -113,23 +147,19 @@ var (
 	}
 )
 
-//GetRegisteredServices - Gets all the registered services list
-func GetRegisteredServices() map[string]*Service {
-	return registeredServices
-}
-
 // ServiceRegistration - Service Registration features
 type ServiceRegistration interface {
-	RegisterService(name, version, baseURL *string) (*Service, error)
-	UnregisterService(name, version string)
-	GetService(name string, version string) (*Service, error)
-	RoutesRegistered() int
+	RegisterService(namespace, name, version string, baseURL *string, mode *string) (*Service, error)
+	UnregisterService(namespace, name, version string)
+	GetService(namespace, name, version string) (*Service, error)
+	GetServiceByID(serviceID string) (*Service, error)
+	GetRegisteredServices() map[string]*Service
 }
 
 // APIRegistration - API Registration features
 type APIRegistration interface {
-	RegisterAPI(url string, httpVerb Verb, payload Payload, resp *MockedResponse, invocationMode *string) (*API, error)
-	RegisterAPIWithLatency(url string, httpVerb Verb, payload Payload, resp *MockedResponse, invocationMode *string) (*APIWithLatency, error)
+	RegisterAPI(serviceID, url string, httpVerb Verb, payload Payload, resp *MockedResponse, invocationMode *string) (*API, error)
+	RegisterAPIWithLatency(serviceID, url string, httpVerb Verb, payload Payload, latency float32, resp *MockedResponse, invocationMode *string) (*APIWithLatency, error)
 }
 
 // Feature Implementations
@@ -148,8 +178,13 @@ func InterfaceToJSONString(data interface{}) (*string, error) {
 	return &dataJSON, nil
 }
 
-func getServiceKey(name, version string) string {
-	return name + "." + version
+func getServiceKey(namespace, name, version string) string {
+	return NamespacedServiceID(namespace, name+"."+version)
+}
+
+// ServiceKey - Key a service is registered with (its ID) for the given namespace, name and version
+func ServiceKey(namespace, name, version string) string {
+	return getServiceKey(namespace, name, version)
 }
 
 func (s *Service) validateServiceMode() (*string, error) {
@@ -158,53 +193,12 @@ func (s *Service) validateServiceMode() (*string, error) {
 		return &defMode, nil
 	}
 	if *s.InvocationMode != defaultMode && s.BaseURL == nil {
-		return nil, fmt.Errorf(fmt.Sprintf("Mode %s is not supported if services' base_url is not set", *s.InvocationMode))
+		return nil, NewError(ErrInvalidMode, "Mode %s is not supported if services' base_url is not set", *s.InvocationMode)
 	}
 	if supporteMode, OK := serviceModes[*s.InvocationMode]; OK {
 		return &supporteMode, nil
 	}
-	return nil, fmt.Errorf(fmt.Sprintf("Invalid mode %s", *s.InvocationMode))
-}
-
-// RegisterService - Registers a specific service name and version
-// name, version is considered to uniquely identify a registered service
-func RegisterService(name, version string, baseURL *string, mode *string) (*Service, error) {
-	serviceKey := getServiceKey(name, version)
-	if service, OK := registeredServices[serviceKey]; OK {
-		return nil, fmt.Errorf("%v already registered", service)
-	}
-	service := &Service{serviceKey, name, version, make(map[string]*API), baseURL, mode, nil}
-	serviceMode, err := service.validateServiceMode()
-	if err != nil {
-		return nil, err
-	}
-	service.InvocationMode = serviceMode
-	if *service.InvocationMode == "spt" {
-		service.ReverseProxy = proxy.NewReverseProxy(*service.BaseURL)
-	}
-	registeredServices[service.ID] = service
-	return service, nil
-}
-
-// UnregisterService - Service unregistration feature remove the service in a no-op fashion
-func UnregisterService(name, version string) {
-	delete(registeredServices, getServiceKey(name, version))
-}
-
-// GetService - Lookup for registered service by name,version; errs if not found
-func GetService(name, version string) (*Service, error) {
-	if service, OK := registeredServices[getServiceKey(name, version)]; OK {
-		return service, nil
-	}
-	return nil, fmt.Errorf("Service with name=%s, version=%s tuple is not registered", name, version)
-}
-
-// GetServiceByID - Lookup for registerd service by id, errs if not found
-func GetServiceByID(serviceID string) (*Service, error) {
-	if service, OK := registeredServices[serviceID]; OK {
-		return service, nil
-	}
-	return nil, fmt.Errorf("Service with id=%v is not registered", serviceID)
+	return nil, NewError(ErrInvalidMode, "Invalid mode %s", *s.InvocationMode)
 }
 
 //
@@ -266,11 +260,11 @@ func GetPayloadSeed(payload Payload) ([]byte, error) {
 	return payloadSeed, nil
 }
 
-// GenerateAPIID - Generates the unique API ID hased using - API method, API Url and Request Payload (if any)
+// GenerateAPIID - Generates the unique API ID hased using - API method, API Url (query params in canonical order) and Request Payload (if any)
 // returns APIID, api id generation seeds / hashes
 func GenerateAPIID(url string, verb Verb, payload Payload) (*string, *IDSeeds, error) {
 	var idSeeds IDSeeds
-	apiIDSeed := GetCoreSeed(url, verb)
+	apiIDSeed := GetCoreSeed(canonicalURL(url), verb)
 	idSeeds.CoreSeed = apiIDSeed
 	if payload != nil {
 		payloadSeed, err := GetPayloadSeed(payload)
@@ -285,10 +279,6 @@ func GenerateAPIID(url string, verb Verb, payload Payload) (*string, *IDSeeds, e
 	return &apiID, &idSeeds, nil
 }
 
-func (s *Service) registerAPI(api *API) {
-	s.registeredAPIs[api.ID] = api
-}
-
 // RoutesRegistered - Returns numbers of APIs registered for the service
 func (s *Service) RoutesRegistered() int {
 	return len(s.registeredAPIs)
@@ -301,58 +291,12 @@ func (s *Service) validateAPIMode(apiMode *string) (*string, error) {
 		return &defMode, nil
 	}
 	if *s.InvocationMode == defaultMode && *apiMode != defaultMode && s.BaseURL == nil {
-		return nil, fmt.Errorf(fmt.Sprintf("API mode %s is not supported if services' base_url is not set", *apiMode))
+		return nil, NewError(ErrInvalidMode, "API mode %s is not supported if services' base_url is not set", *apiMode)
 	}
 	if supporteMode, OK := apiModes[*apiMode]; OK {
 		return &supporteMode, nil
 	}
-	return nil, fmt.Errorf(fmt.Sprintf("API mode %s not supported", *apiMode))
-}
-
-//RegisterAPI - Registers an API for a given service
-func (s *Service) RegisterAPI(url string, verb Verb, payload Payload, response *MockedResponse, mode *string) (*API, error) {
-	apiKey, apiSeeds, err := GenerateAPIID(url, verb, payload)
-	if err != nil {
-		return nil, fmt.Errorf("Error generating API ID :: %v", err.Error())
-	}
-	if api, OK := s.registeredAPIs[*apiKey]; OK {
-		return nil, fmt.Errorf("%v already registered with %v", api, s)
-	}
-	selfURL := fmt.Sprintf("/%s%s", s.ID, url)
-	api := &API{*apiKey, url, verb, payload, s.ID, apiSeeds, response, selfURL, mode}
-	apiMode, err := s.validateAPIMode(api.InvocationMode)
-	if err != nil {
-		return nil, err
-	}
-	api.InvocationMode = apiMode
-	if *api.InvocationMode == "apt" && s.ReverseProxy == nil {
-		s.ReverseProxy = proxy.NewReverseProxy(*s.BaseURL)
-	}
-	s.registerAPI(api)
-	return api, nil
-}
-
-//RegisterAPIWithLatency - Registers an API for a given service with specified mocked latency
-func (s *Service) RegisterAPIWithLatency(url string, verb Verb, payload Payload, latency float32, response *MockedResponse, mode *string) (*APIWithLatency, error) {
-	apiKey, apiSeeds, err := GenerateAPIID(url, verb, payload)
-	if err != nil {
-		return nil, fmt.Errorf("Error generating API ID :: %v", err.Error())
-	}
-	if api, OK := s.registeredAPIs[*apiKey]; OK {
-		return nil, fmt.Errorf("%v already registered with %v", api, s)
-	}
-	selfURL := fmt.Sprintf("/%s%s", s.ID, url)
-	api := &APIWithLatency{API{*apiKey, url, verb, payload, s.ID, apiSeeds, response, selfURL, mode}, latency}
-	apiMode, err := s.validateAPIMode(api.InvocationMode)
-	if err != nil {
-		return nil, err
-	}
-	api.InvocationMode = apiMode
-	if *api.InvocationMode == "apt" && s.ReverseProxy == nil {
-		s.ReverseProxy = proxy.NewReverseProxy(*s.BaseURL)
-	}
-	s.registerAPI(&(api.API))
-	return api, nil
+	return nil, NewError(ErrInvalidMode, "API mode %s not supported", *apiMode)
 }
 
 // GetAPIByID - Fetches registered api by api id, errs if not found
@@ -360,7 +304,7 @@ func (s *Service) GetAPIByID(apiID string) (*API, error) {
 	if api, OK := s.registeredAPIs[apiID]; OK {
 		return api, nil
 	}
-	return nil, fmt.Errorf("API, Service (%v, %v) combination not found", apiID, s.ID)
+	return nil, NewError(ErrNotFound, "API, Service (%v, %v) combination not found", apiID, s.ID)
 }
 
 // GetAPI - Fetches registered api by api id, errs if not found
@@ -372,12 +316,16 @@ func (s *Service) GetAPI(url string, verb Verb, payload Payload) (*API, error) {
 	if api, OK := s.registeredAPIs[*apiID]; OK {
 		return api, nil
 	}
-	return nil, fmt.Errorf("API, Service (%v, %v) combination not found", apiID, s.ID)
+	return nil, NewError(ErrNotFound, "API, Service (%v, %v) combination not found", apiID, s.ID)
 }
 
 // GetRegisteredAPIs - Returns a map of all the registered APIs in the service
 func (s *Service) GetRegisteredAPIs() map[string]*API {
-	return s.registeredAPIs
+	registeredAPIs := make(map[string]*API, len(s.registeredAPIs))
+	for apiID, api := range s.registeredAPIs {
+		registeredAPIs[apiID] = api
+	}
+	return registeredAPIs
 }
 
 // IsPassThroughAllowed - Checks if the services is configured for pass-through / proxy mode
@@ -0,0 +1,490 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry - Concurrency safe registry owning all the registered services and their APIs
+// Readers work lock free on an immutable snapshot of the services, writers are serialised
+// and publish a fresh snapshot (copy-on-write) so a reader never sees a half applied change
+type Registry struct {
+	writeLock sync.Mutex
+	services  atomic.Value
+	watchers  map[int]func(event StoreEvent)
+	watcherID int
+	// persist - Optional hook run with the new services map before it is published, the change is dropped if it errs
+	persist func(services map[string]*Service) error
+	// history - Revisions of every service and API, guarded by writeLock
+	history map[revisionKey][]Revision
+	changes changeFeed
+}
+
+// Tx - A pending change to the registry, collects the events to notify once published
+// A Tx is only valid within the Update call it was handed to
+type Tx struct {
+	services map[string]*Service
+	// owned - Services already copied within this change, safe to modify in place
+	owned  map[string]bool
+	events []StoreEvent
+	// unproxied - Reverse proxies of the services removed or no longer passing requests through within this change, closed once it is published
+	unproxied []*ServiceProxy
+	// revisions - Revisions of the services and APIs changed within this change, in order
+	revisions []pendingRevision
+	// history - Revisions already published, read only
+	history         map[revisionKey][]Revision
+	author, comment string
+}
+
+var _ Store = (*Registry)(nil)
+
+// NewRegistry - Creates an empty registry
+func NewRegistry() *Registry {
+	registry := &Registry{}
+	registry.services.Store(make(map[string]*Service))
+	return registry
+}
+
+// snapshot - Current immutable services map, must never be modified in place
+func (r *Registry) snapshot() map[string]*Service {
+	return r.services.Load().(map[string]*Service)
+}
+
+func (tx *Tx) record(eventType StoreEventType, serviceID, apiID string) {
+	event := StoreEvent{eventType, serviceID, apiID}
+	tx.events = append(tx.events, event)
+	tx.recordRevision(event)
+}
+
+// mutate - Runs the change against a copy of the current services map and publishes it,
+// nothing is published if the change errs
+func (r *Registry) mutate(change func(tx *Tx) error) error {
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+	current := r.snapshot()
+	tx := &Tx{services: make(map[string]*Service, len(current)), owned: make(map[string]bool), history: r.history}
+	for serviceID, service := range current {
+		tx.services[serviceID] = service
+	}
+	if err := change(tx); err != nil {
+		return err
+	}
+	if len(tx.events) == 0 {
+		return nil
+	}
+	if r.persist != nil {
+		if err := r.persist(tx.services); err != nil {
+			return fmt.Errorf("Unable to persist registry change :: %v", err.Error())
+		}
+	}
+	r.services.Store(tx.services)
+	r.publishRevisions(tx)
+	r.publishChanges(tx)
+	for _, serviceProxy := range tx.unproxied {
+		// Requests holding the previous services may still be proxying, Close waits for them
+		go serviceProxy.Close()
+	}
+	for _, event := range tx.events {
+		for _, watcher := range r.watchers {
+			watcher(event)
+		}
+	}
+	return nil
+}
+
+// Watch - Registers a watcher notified of every change published to the registry, in order
+// Watchers are called synchronously with writes serialised and hence must not write to the registry themselves
+func (r *Registry) Watch(watcher func(event StoreEvent)) (unwatch func()) {
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+	if r.watchers == nil {
+		r.watchers = make(map[int]func(event StoreEvent))
+	}
+	r.watcherID++
+	watcherID := r.watcherID
+	r.watchers[watcherID] = watcher
+	return func() {
+		r.writeLock.Lock()
+		defer r.writeLock.Unlock()
+		delete(r.watchers, watcherID)
+	}
+}
+
+// clone - Shallow copy of the service with its own APIs map, used by writers before changing a published service
+func (s *Service) clone() *Service {
+	service := *s
+	service.registeredAPIs = make(map[string]*API, len(s.registeredAPIs))
+	for apiID, api := range s.registeredAPIs {
+		service.registeredAPIs[apiID] = api
+	}
+	return &service
+}
+
+// GetRegisteredServices - Gets all the registered services list
+func (r *Registry) GetRegisteredServices() map[string]*Service {
+	current := r.snapshot()
+	services := make(map[string]*Service, len(current))
+	for serviceID, service := range current {
+		services[serviceID] = service
+	}
+	return services
+}
+
+// serviceNamePattern - Characters allowed in service names and versions, the service id is a segment of the mock routes
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ValidateServiceName - Checks the service name and version are made of letters, digits, '.', '-' and '_' only
+func ValidateServiceName(name, version string) error {
+	if !serviceNamePattern.MatchString(name) {
+		return NewError(ErrInvalidArgument, "Invalid service name %q, only letters, digits, '.', '-' and '_' are allowed", name)
+	}
+	if !serviceNamePattern.MatchString(version) {
+		return NewError(ErrInvalidArgument, "Invalid service version %q, only letters, digits, '.', '-' and '_' are allowed", version)
+	}
+	return nil
+}
+
+// registerService - Validates and adds a new service to the pending change
+func (tx *Tx) registerService(namespace, name, version string, baseURL *string, mode *string) (*Service, error) {
+	if err := ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+	if err := ValidateServiceName(name, version); err != nil {
+		return nil, err
+	}
+	serviceKey := getServiceKey(namespace, name, version)
+	if registered, OK := tx.services[serviceKey]; OK {
+		return nil, NewError(ErrAlreadyRegistered, "%v already registered", registered)
+	}
+	service := &Service{ID: serviceKey, Name: name, Version: version, Namespace: namespace, registeredAPIs: make(map[string]*API), BaseURL: baseURL, InvocationMode: mode, CreatedAt: time.Now().UTC()}
+	serviceMode, err := service.validateServiceMode()
+	if err != nil {
+		return nil, err
+	}
+	service.InvocationMode = serviceMode
+	if *service.InvocationMode == "spt" {
+		service.ReverseProxy = NewServiceProxy(*service.BaseURL)
+	}
+	tx.services[service.ID] = service
+	tx.owned[service.ID] = true
+	tx.record(ServiceRegistered, service.ID, "")
+	return service, nil
+}
+
+// writableService - Service that can be changed in place within the pending change, cloned on first use
+func (tx *Tx) writableService(serviceID string) (*Service, error) {
+	registered, OK := tx.services[serviceID]
+	if !OK {
+		return nil, NewError(ErrNotFound, "Service with id=%v is not registered", serviceID)
+	}
+	if tx.owned[serviceID] {
+		return registered, nil
+	}
+	service := registered.clone()
+	tx.services[serviceID] = service
+	tx.owned[serviceID] = true
+	return service, nil
+}
+
+// replaceService - Applies the change to the writable service, a change reporting false leaves the service as is.
+// Meant to go along with the registration or update of the service, it is recorded as an update only if the service did not change otherwise
+func (tx *Tx) replaceService(serviceID string, change func(service *Service) bool) (*Service, error) {
+	service, err := tx.writableService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if change(service) && !tx.changed(serviceID, "") {
+		tx.record(ServiceUpdated, serviceID, "")
+	}
+	return service, nil
+}
+
+// replaceAPI - Applies the change to a copy of the API put in place of the registered one, a change reporting false leaves the API as is.
+// Published APIs are never changed in place, requests being served may still hold them.
+// Meant to go along with the registration or update of the API, it is recorded as an update only if the API did not change otherwise
+func (tx *Tx) replaceAPI(serviceID, apiID string, change func(api *API) bool) (*API, error) {
+	service, err := tx.writableService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	registered, err := service.GetAPIByID(apiID)
+	if err != nil {
+		return nil, err
+	}
+	api := *registered
+	if !change(&api) {
+		return registered, nil
+	}
+	service.registeredAPIs[apiID] = &api
+	if !tx.changed(serviceID, apiID) {
+		tx.record(APIUpdated, serviceID, apiID)
+	}
+	return &api, nil
+}
+
+// RegisterService - Registers a specific service name and version
+// name, version is considered to uniquely identify a registered service
+func (r *Registry) RegisterService(namespace, name, version string, baseURL *string, mode *string) (*Service, error) {
+	var service *Service
+	err := r.mutate(func(tx *Tx) error {
+		var err error
+		service, err = tx.registerService(namespace, name, version, baseURL, mode)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// UnregisterService - Service unregistration feature remove the service in a no-op fashion
+func (r *Registry) UnregisterService(namespace, name, version string) {
+	r.mutate(func(tx *Tx) error {
+		tx.UnregisterService(getServiceKey(namespace, name, version))
+		return nil
+	})
+}
+
+// GetService - Lookup for registered service by name,version; errs if not found
+func (r *Registry) GetService(namespace, name, version string) (*Service, error) {
+	if service, OK := r.snapshot()[getServiceKey(namespace, name, version)]; OK {
+		return service, nil
+	}
+	return nil, NewError(ErrNotFound, "Service with name=%s, version=%s tuple is not registered", name, version)
+}
+
+// GetServiceByID - Lookup for registerd service by id, errs if not found
+func (r *Registry) GetServiceByID(serviceID string) (*Service, error) {
+	if service, OK := r.snapshot()[serviceID]; OK {
+		return service, nil
+	}
+	return nil, NewError(ErrNotFound, "Service with id=%v is not registered", serviceID)
+}
+
+// newAPI - Builds and validates an API for the service without registering it
+func (s *Service) newAPI(profile, url string, matchers *RequestMatchers, verb Verb, payload Payload, response *MockedResponse, mode *string) (*API, error) {
+	if err := ValidateProfile(profile); err != nil {
+		return nil, err
+	}
+	routeID, apiSeeds, err := GenerateAPIID(url, verb, payload)
+	if err != nil {
+		return nil, fmt.Errorf("Error generating API ID :: %v", err.Error())
+	}
+	matchers, err = matchers.compile(url)
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := MatchersAPIID(*routeID, matchers)
+	if err != nil {
+		return nil, fmt.Errorf("Error generating API ID :: %v", err.Error())
+	}
+	apiID := ProfileAPIID(apiKey, profile)
+	if api, OK := s.registeredAPIs[apiID]; OK {
+		return nil, NewError(ErrAlreadyRegistered, "%v already registered with %v", api, s)
+	}
+	template, err := parsePathTemplate(url)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := compileURLPattern(url)
+	if err != nil {
+		return nil, err
+	}
+	selfURL := fmt.Sprintf("/%s%s", s.ID, url)
+	api := &API{apiID, url, verb, payload, s.ID, apiSeeds, response, selfURL, mode, nil, nil, profile, matchers, nil, time.Now().UTC(), &invocationCounter{}, template, pattern, *routeID}
+	if clash := s.templateClash(api); clash != nil {
+		return nil, NewError(ErrAlreadyRegistered, "%v matches the same urls as %v already registered with %v", api.URL, clash, s)
+	}
+	apiMode, err := s.validateAPIMode(api.InvocationMode)
+	if err != nil {
+		return nil, err
+	}
+	api.InvocationMode = apiMode
+	return api, nil
+}
+
+// registerAPI - Adds the API to the pending change, setting up the service reverse proxy if the API needs one
+func (tx *Tx) registerAPI(serviceID string, build func(service *Service) (*API, error)) (*API, error) {
+	service, err := tx.writableService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	api, err := build(service)
+	if err != nil {
+		return nil, err
+	}
+	if *api.InvocationMode == "apt" && service.ReverseProxy == nil {
+		service.ReverseProxy = NewServiceProxy(*service.BaseURL)
+	}
+	service.registeredAPIs[api.ID] = api
+	tx.record(APIRegistered, service.ID, api.ID)
+	return api, nil
+}
+
+// registerAPI - Publishes the API built for the service
+func (r *Registry) registerAPI(serviceID string, build func(service *Service) (*API, error)) (*API, error) {
+	var api *API
+	err := r.mutate(func(tx *Tx) error {
+		var err error
+		api, err = tx.registerAPI(serviceID, build)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return api, nil
+}
+
+// RegisterAPI - Registers an API for a given service
+func (r *Registry) RegisterAPI(serviceID, url string, verb Verb, payload Payload, response *MockedResponse, mode *string) (*API, error) {
+	return r.registerAPI(serviceID, func(service *Service) (*API, error) {
+		return service.newAPI(DefaultProfile, url, nil, verb, payload, response, mode)
+	})
+}
+
+// RegisterAPIWithLatency - Registers an API for a given service with specified mocked latency
+func (r *Registry) RegisterAPIWithLatency(serviceID, url string, verb Verb, payload Payload, latency float32, response *MockedResponse, mode *string) (*APIWithLatency, error) {
+	var apiWithLatency *APIWithLatency
+	_, err := r.registerAPI(serviceID, func(service *Service) (*API, error) {
+		api, err := service.newAPI(DefaultProfile, url, nil, verb, payload, response, mode)
+		if err != nil {
+			return nil, err
+		}
+		apiWithLatency = &APIWithLatency{*api, latency}
+		return &apiWithLatency.API, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apiWithLatency, nil
+}
+
+// UnregisterServiceByID - Removes the service along with all its APIs and closes its reverse proxy, errs if not registered
+func (r *Registry) UnregisterServiceByID(serviceID string) (*Service, error) {
+	var service *Service
+	err := r.mutate(func(tx *Tx) error {
+		var err error
+		service, err = tx.GetServiceByID(serviceID)
+		if err != nil {
+			return err
+		}
+		tx.UnregisterService(serviceID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// UnregisterAPI - Removes the API from the given service, errs if either of them is not registered
+func (r *Registry) UnregisterAPI(serviceID, apiID string) (*API, error) {
+	var api *API
+	err := r.mutate(func(tx *Tx) error {
+		var err error
+		api, err = tx.UnregisterAPI(serviceID, apiID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return api, nil
+}
+
+// Update - Applies all the changes made through the Tx atomically, nothing is published if change errs
+func (r *Registry) Update(change func(tx *Tx) error) error {
+	return r.mutate(change)
+}
+
+// GetRegisteredServices - Gets all the services as they are within the pending change
+func (tx *Tx) GetRegisteredServices() map[string]*Service {
+	services := make(map[string]*Service, len(tx.services))
+	for serviceID, service := range tx.services {
+		services[serviceID] = service
+	}
+	return services
+}
+
+// GetServiceByID - Lookup for service by id within the pending change, errs if not found
+func (tx *Tx) GetServiceByID(serviceID string) (*Service, error) {
+	if service, OK := tx.services[serviceID]; OK {
+		return service, nil
+	}
+	return nil, NewError(ErrNotFound, "Service with id=%v is not registered", serviceID)
+}
+
+// RegisterService - Registers a specific service name and version within the pending change
+func (tx *Tx) RegisterService(namespace, name, version string, baseURL *string, mode *string) (*Service, error) {
+	return tx.registerService(namespace, name, version, baseURL, mode)
+}
+
+// UnregisterService - Removes the service along with all its APIs in a no-op fashion, reports if it was registered
+func (tx *Tx) UnregisterService(serviceID string) bool {
+	return tx.unregisterService(serviceID, ServiceUnregistered)
+}
+
+func (tx *Tx) unregisterService(serviceID string, eventType StoreEventType) bool {
+	service, OK := tx.services[serviceID]
+	if !OK {
+		return false
+	}
+	delete(tx.services, serviceID)
+	delete(tx.owned, serviceID)
+	if service.ReverseProxy != nil {
+		tx.unproxied = append(tx.unproxied, service.ReverseProxy)
+	}
+	tx.record(eventType, serviceID, "")
+	return true
+}
+
+// RegisterAPI - Registers an untagged API for a given service within the pending change
+func (tx *Tx) RegisterAPI(serviceID, url string, verb Verb, payload Payload, response *MockedResponse, mode *string) (*API, error) {
+	return tx.RegisterProfileAPI(serviceID, DefaultProfile, url, nil, verb, payload, response, mode)
+}
+
+// RegisterProfileAPI - Registers an API serving in the given profile only for a given service within the pending change,
+// matching on the request matchers (if any) on top of url, verb and payload
+func (tx *Tx) RegisterProfileAPI(serviceID, profile, url string, matchers *RequestMatchers, verb Verb, payload Payload, response *MockedResponse, mode *string) (*API, error) {
+	return tx.registerAPI(serviceID, func(service *Service) (*API, error) {
+		return service.newAPI(profile, url, matchers, verb, payload, response, mode)
+	})
+}
+
+// needsProxy - Checks if the service or any of its APIs pass the requests through to the actual service
+func (s *Service) needsProxy() bool {
+	if s.IsPassThroughAllowed() {
+		return true
+	}
+	for _, api := range s.registeredAPIs {
+		if api.IsPassThroughAPI() {
+			return true
+		}
+	}
+	return false
+}
+
+// UnregisterAPI - Removes the API from the given service within the pending change, errs if either of them is not registered
+func (tx *Tx) UnregisterAPI(serviceID, apiID string) (*API, error) {
+	return tx.unregisterAPI(serviceID, apiID, APIUnregistered)
+}
+
+func (tx *Tx) unregisterAPI(serviceID, apiID string, eventType StoreEventType) (*API, error) {
+	service, err := tx.writableService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	api, err := service.GetAPIByID(apiID)
+	if err != nil {
+		return nil, err
+	}
+	delete(service.registeredAPIs, apiID)
+	if service.ReverseProxy != nil && !service.needsProxy() {
+		tx.unproxied = append(tx.unproxied, service.ReverseProxy)
+		service.ReverseProxy = nil
+	}
+	tx.record(eventType, service.ID, apiID)
+	return api, nil
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+const (
+	hammerWorkers = 8
+	hammerRounds  = 100
+)
+
+// hammer - Runs work on hammerWorkers goroutines at once, hammerRounds times each
+func hammer(work func(worker, round int)) {
+	var wg sync.WaitGroup
+	for worker := 0; worker < hammerWorkers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for round := 0; round < hammerRounds; round++ {
+				work(worker, round)
+			}
+		}(worker)
+	}
+	wg.Wait()
+}
+
+func mockedResponse(body string) *MockedResponse {
+	return &MockedResponse{200, Payload{"body": body}}
+}
+
+func TestRegistryParallelRegistrationAndLookup(t *testing.T) {
+	registry := NewRegistry()
+	service, err := registry.RegisterService(DefaultNamespace, "hammer", "1", nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to register service :: %v", err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	done := make(chan struct{})
+	go func() {
+		// Reader looking the APIs up while they are being registered
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			current, err := registry.GetServiceByID(service.ID)
+			if err != nil {
+				t.Errorf("Service lookup failed :: %v", err)
+				return
+			}
+			for _, api := range current.GetRegisteredAPIs() {
+				match, err := current.MatchAPI(&APIRequest{URL: api.URL, Verb: GET, Payload: Payload{}})
+				if err != nil {
+					t.Errorf("API %v of a published service not matched :: %v", api.URL, err)
+					return
+				}
+				match.API.Invoke()
+			}
+		}
+	}()
+	hammer(func(worker, round int) {
+		url := fmt.Sprintf("/worker/%d/round/%d", worker, round)
+		if _, err := registry.RegisterAPI(service.ID, url, GET, Payload{}, mockedResponse(url), nil); err != nil {
+			t.Errorf("Unable to register API %v :: %v", url, err)
+		}
+		if _, err := registry.RegisterService(DefaultNamespace, fmt.Sprintf("worker%d", worker), fmt.Sprintf("%d", round), nil, nil); err != nil {
+			t.Errorf("Unable to register service :: %v", err)
+		}
+	})
+	close(done)
+	wg.Wait()
+	current, _ := registry.GetServiceByID(service.ID)
+	if registered := current.RoutesRegistered(); registered != hammerWorkers*hammerRounds {
+		t.Fatalf("Expected %v APIs registered, got %v", hammerWorkers*hammerRounds, registered)
+	}
+	if registered := len(registry.GetRegisteredServices()); registered != hammerWorkers*hammerRounds+1 {
+		t.Fatalf("Expected %v services registered, got %v", hammerWorkers*hammerRounds+1, registered)
+	}
+}
+
+func TestRegistryParallelInvocations(t *testing.T) {
+	registry := NewRegistry()
+	service, err := registry.RegisterService(DefaultNamespace, "hammer", "1", nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to register service :: %v", err)
+	}
+	api, err := registry.RegisterAPI(service.ID, "/limited", GET, Payload{}, mockedResponse("limited"), nil)
+	if err != nil {
+		t.Fatalf("Unable to register API :: %v", err)
+	}
+	times := hammerWorkers * hammerRounds / 2
+	err = registry.Update(func(tx *Tx) error {
+		return tx.SetAPITimes(service.ID, api.ID, &times)
+	})
+	if err != nil {
+		t.Fatalf("Unable to limit API :: %v", err)
+	}
+	var served int64
+	var servedLock sync.Mutex
+	hammer(func(worker, round int) {
+		current, err := registry.GetServiceByID(service.ID)
+		if err != nil {
+			t.Errorf("Service lookup failed :: %v", err)
+			return
+		}
+		// Done serving its times the API is treated as unregistered
+		if _, err := current.ServeAPI(&APIRequest{URL: "/limited", Verb: GET, Payload: Payload{}}); err == nil {
+			servedLock.Lock()
+			served++
+			servedLock.Unlock()
+		}
+		// Writers copying the service and its APIs while the limited one is being invoked
+		if round%10 == 0 {
+			labels := Labels{"round": fmt.Sprintf("%d", round)}
+			if err := registry.Update(func(tx *Tx) error { return tx.SetAPILabels(service.ID, api.ID, labels) }); err != nil {
+				t.Errorf("Unable to label API :: %v", err)
+			}
+		}
+	})
+	if served != int64(times) {
+		t.Fatalf("Expected the API to serve %v times, served %v", times, served)
+	}
+}
+
+func TestRegistryParallelUpdatesAreAtomic(t *testing.T) {
+	registry := NewRegistry()
+	hammer(func(worker, round int) {
+		name := fmt.Sprintf("worker%d", worker)
+		err := registry.Update(func(tx *Tx) error {
+			service, err := tx.RegisterService(DefaultNamespace, name, fmt.Sprintf("%d", round), nil, nil)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.RegisterAPI(service.ID, "/a", GET, Payload{}, mockedResponse("a"), nil); err != nil {
+				return err
+			}
+			_, err = tx.RegisterAPI(service.ID, "/b", GET, Payload{}, mockedResponse("b"), nil)
+			return err
+		})
+		if err != nil {
+			t.Errorf("Unable to apply change :: %v", err)
+		}
+		// A published service always carries both APIs of the change that registered it
+		for _, service := range registry.GetRegisteredServices() {
+			if registered := service.RoutesRegistered(); registered != 2 {
+				t.Errorf("Service %v published with %v APIs", service.ID, registered)
+			}
+		}
+	})
+}
+
+func TestRegistryUnregisteringLastPassThroughAPIDropsProxy(t *testing.T) {
+	registry := NewRegistry()
+	baseURL, apt := "http://localhost:9", "apt"
+	service, err := registry.RegisterService(DefaultNamespace, "proxied", "1", &baseURL, nil)
+	if err != nil {
+		t.Fatalf("Unable to register service :: %v", err)
+	}
+	api, err := registry.RegisterAPI(service.ID, "/through", GET, Payload{}, mockedResponse("through"), &apt)
+	if err != nil {
+		t.Fatalf("Unable to register API :: %v", err)
+	}
+	if current, _ := registry.GetServiceByID(service.ID); current.ReverseProxy == nil {
+		t.Fatalf("Expected a proxy for the pass through API")
+	}
+	if _, err := registry.UnregisterAPI(service.ID, api.ID); err != nil {
+		t.Fatalf("Unable to unregister API :: %v", err)
+	}
+	if current, _ := registry.GetServiceByID(service.ID); current.ReverseProxy != nil {
+		t.Fatalf("Expected the proxy dropped along with the last pass through API")
+	}
+}
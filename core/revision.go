@@ -0,0 +1,189 @@
+package core
+
+import "time"
+
+// Kinds of change a Revision records
+const (
+	// RevisionCreated - The service or API got registered
+	RevisionCreated = "created"
+	// RevisionUpdated - The service or API got changed in place
+	RevisionUpdated = "updated"
+	// RevisionDeleted - The service or API got removed
+	RevisionDeleted = "deleted"
+	// RevisionExpired - The service or API got removed once its time to live elapsed
+	RevisionExpired = "expired"
+)
+
+// revisionsKept - Revisions kept per service and per API, the oldest are dropped first
+const revisionsKept = 100
+
+// Revision - A numbered change to a service or API along with its state right after the change (none once deleted)
+// Revisions are numbered per service and per API starting at 1, and kept in memory only
+type Revision struct {
+	Number    int       `json:"revision"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	Change    string    `json:"change"`
+	// Service - State of the service, its APIs have revisions of their own and are hence left out
+	Service *ServiceRecord `json:"service,omitempty"`
+	API     *API           `json:"api,omitempty"`
+}
+
+// revisionKey - Identifies the service (empty apiID) or API revisions are recorded for
+type revisionKey struct {
+	serviceID string
+	apiID     string
+}
+
+// pendingRevision - A revision recorded within a Tx, numbered and timestamped once the change is published
+type pendingRevision struct {
+	key      revisionKey
+	revision Revision
+}
+
+// Annotate - Sets the author and comment of the revisions recorded by the pending change
+func (tx *Tx) Annotate(author, comment string) {
+	tx.author = author
+	tx.comment = comment
+}
+
+// recordRevision - Records the change the event is about, its state is taken once the whole change is done
+func (tx *Tx) recordRevision(event StoreEvent) {
+	revision := Revision{}
+	switch event.Type {
+	case ServiceRegistered, APIRegistered:
+		revision.Change = RevisionCreated
+	case ServiceUpdated, APIUpdated:
+		revision.Change = RevisionUpdated
+	case ServiceExpired, APIExpired:
+		revision.Change = RevisionExpired
+	default:
+		revision.Change = RevisionDeleted
+	}
+	tx.revisions = append(tx.revisions, pendingRevision{revisionKey{event.ServiceID, event.APIID}, revision})
+}
+
+// revisionState - Sets the state of the service or API the revision is about as it is in the services, none if removed
+func (revision *Revision) revisionState(key revisionKey, services map[string]*Service) {
+	service, OK := services[key.serviceID]
+	if !OK || revision.Change == RevisionDeleted || revision.Change == RevisionExpired {
+		return
+	}
+	if key.apiID == "" {
+		revision.Service = &ServiceRecord{Name: service.Name, Version: service.Version, Namespace: service.Namespace, BaseURL: service.BaseURL, InvocationMode: service.InvocationMode, ExpiresAt: service.ExpiresAt, ActiveProfile: service.ActiveProfile, Labels: service.Labels, CreatedAt: service.CreatedAt}
+		return
+	}
+	revision.API = service.registeredAPIs[key.apiID]
+}
+
+// publishRevisions - Numbers the revisions recorded by the published change and appends them to the history
+func (r *Registry) publishRevisions(tx *Tx) {
+	if r.history == nil {
+		r.history = make(map[revisionKey][]Revision)
+	}
+	now := time.Now().UTC()
+	for _, pending := range tx.revisions {
+		revision := pending.revision
+		revision.Timestamp = now
+		revision.Author = tx.author
+		revision.Comment = tx.comment
+		revision.revisionState(pending.key, tx.services)
+		revisions := r.history[pending.key]
+		revision.Number = 1
+		if len(revisions) > 0 {
+			revision.Number = revisions[len(revisions)-1].Number + 1
+		}
+		revisions = append(revisions, revision)
+		if len(revisions) > revisionsKept {
+			revisions = append([]Revision(nil), revisions[len(revisions)-revisionsKept:]...)
+		}
+		r.history[pending.key] = revisions
+	}
+}
+
+// Revisions - Revisions recorded for the service (empty apiID) or API, oldest first, including the ones of removed services and APIs
+func (r *Registry) Revisions(serviceID, apiID string) ([]Revision, error) {
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+	revisions, OK := r.history[revisionKey{serviceID, apiID}]
+	if !OK {
+		if apiID == "" {
+			return nil, NewError(ErrNotFound, "No revisions recorded for service with id=%v", serviceID)
+		}
+		return nil, NewError(ErrNotFound, "No revisions recorded for API with id=%v of service with id=%v", apiID, serviceID)
+	}
+	return append([]Revision(nil), revisions...), nil
+}
+
+// revision - Looks up a revision of the service (empty apiID) or API
+func (tx *Tx) revision(serviceID, apiID string, number int) (*Revision, error) {
+	for _, revision := range tx.history[revisionKey{serviceID, apiID}] {
+		if revision.Number == number {
+			return &revision, nil
+		}
+	}
+	return nil, NewError(ErrNotFound, "Revision %v not found", number)
+}
+
+// RollbackService - Brings the service back to the state of the given revision within the pending change,
+// registering it again if removed since or removing it if the revision is its removal. Its APIs are left as they are.
+// Errs if the revision is a removal and the service is already removed, the rollback would not change anything
+func (tx *Tx) RollbackService(serviceID string, number int) error {
+	revision, err := tx.revision(serviceID, "", number)
+	if err != nil {
+		return err
+	}
+	record := revision.Service
+	if record == nil {
+		if !tx.UnregisterService(serviceID) {
+			return NewError(ErrNotFound, "Service with id=%v is already removed, nothing to roll back to revision %v", serviceID, number)
+		}
+		return nil
+	}
+	if _, OK := tx.services[serviceID]; OK {
+		_, err = tx.UpdateService(serviceID, record.BaseURL, record.InvocationMode)
+	} else {
+		_, err = tx.registerService(record.Namespace, record.Name, record.Version, record.BaseURL, record.InvocationMode)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.restoreService(serviceID, record)
+}
+
+// RollbackAPI - Brings the API back to the state of the given revision within the pending change,
+// registering it again if removed since or removing it if the revision is its removal. Its service has to be registered.
+// Errs if the revision is a removal and the API is already removed, the rollback would not change anything
+func (tx *Tx) RollbackAPI(serviceID, apiID string, number int) error {
+	revision, err := tx.revision(serviceID, apiID, number)
+	if err != nil {
+		return err
+	}
+	service, err := tx.GetServiceByID(serviceID)
+	if err != nil {
+		return err
+	}
+	_, registered := service.registeredAPIs[apiID]
+	api := revision.API
+	switch {
+	case api == nil && registered:
+		_, err = tx.UnregisterAPI(serviceID, apiID)
+	case api == nil:
+		return NewError(ErrNotFound, "API with id=%v is already removed, nothing to roll back to revision %v", apiID, number)
+	case registered:
+		_, err = tx.UpdateAPI(serviceID, apiID, api.APIResponse, api.InvocationMode)
+	default:
+		_, err = tx.RegisterProfileAPI(serviceID, api.Profile, api.URL, api.Matchers, api.APIVerb, api.APIPayload, api.APIResponse, api.InvocationMode)
+	}
+	if err != nil || api == nil {
+		return err
+	}
+	if err := tx.SetAPIExpiry(serviceID, apiID, api.ExpiresAt); err != nil {
+		return err
+	}
+	if err := tx.SetAPILabels(serviceID, apiID, api.Labels); err != nil {
+		return err
+	}
+	return tx.SetAPITimes(serviceID, apiID, api.Times)
+}
@@ -0,0 +1,290 @@
+package core
+
+import (
+	json "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SnapshotVersion - Version of the snapshot document written by this build
+const SnapshotVersion = 1
+
+// Snapshot - Consistent point in time copy of all the registered services and their APIs
+type Snapshot struct {
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	Services  []ServiceRecord `json:"services"`
+}
+
+// ServiceRecord - Persisted form of a service along with its APIs
+type ServiceRecord struct {
+	Name           string     `json:"name"`
+	Version        string     `json:"version"`
+	Namespace      string     `json:"namespace,omitempty"`
+	BaseURL        *string    `json:"base_url,omitempty"`
+	InvocationMode *string    `json:"invocation_mode,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	ActiveProfile  string     `json:"active_profile,omitempty"`
+	Labels         Labels     `json:"labels,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	APIs           []*API     `json:"apis,omitempty"`
+}
+
+// key - Key the service of the record is registered with
+func (record *ServiceRecord) key() string {
+	return getServiceKey(record.Namespace, record.Name, record.Version)
+}
+
+// newSnapshot - Builds the snapshot of the services, sorted by service and API id so that it diffs cleanly
+func newSnapshot(services map[string]*Service) *Snapshot {
+	snapshot := &Snapshot{SnapshotVersion, time.Now().UTC(), make([]ServiceRecord, 0, len(services))}
+	for _, service := range services {
+		record := ServiceRecord{service.Name, service.Version, service.Namespace, service.BaseURL, service.InvocationMode, service.ExpiresAt, service.ActiveProfile, service.Labels, service.CreatedAt, make([]*API, 0, len(service.registeredAPIs))}
+		for _, api := range service.registeredAPIs {
+			record.APIs = append(record.APIs, api)
+		}
+		sort.Slice(record.APIs, func(i, j int) bool { return record.APIs[i].ID < record.APIs[j].ID })
+		snapshot.Services = append(snapshot.Services, record)
+	}
+	sort.Slice(snapshot.Services, func(i, j int) bool {
+		return snapshot.Services[i].key() < snapshot.Services[j].key()
+	})
+	return snapshot
+}
+
+// Snapshot - Takes a consistent snapshot of the registry
+func (r *Registry) Snapshot() *Snapshot {
+	return newSnapshot(r.snapshot())
+}
+
+// ImportConflict - A service or API of an imported snapshot clashing with one already registered
+type ImportConflict struct {
+	ServiceID string `json:"service_id"`
+	APIID     string `json:"api_id,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// ImportConflictError - Reports all the conflicts that prevented a snapshot from being merged
+type ImportConflictError struct {
+	Conflicts []ImportConflict
+}
+
+func (e *ImportConflictError) Error() string {
+	return fmt.Sprintf("Snapshot conflicts with %v registered services/APIs", len(e.Conflicts))
+}
+
+// Unwrap - Conflicts are services and APIs already registered
+func (e *ImportConflictError) Unwrap() error {
+	return ErrAlreadyRegistered
+}
+
+// checkSnapshot - Checks the snapshot version, that its services are named and that none of its APIs is left empty
+func checkSnapshot(snapshot *Snapshot) error {
+	if snapshot.Version != SnapshotVersion {
+		return NewError(ErrInvalidArgument, "Snapshot version %v not supported, expected %v", snapshot.Version, SnapshotVersion)
+	}
+	for _, record := range snapshot.Services {
+		if record.Name == "" || record.Version == "" {
+			return NewError(ErrInvalidArgument, "Snapshot has a service without a name or version, both are required")
+		}
+		for _, api := range record.APIs {
+			if api == nil {
+				return NewError(ErrInvalidArgument, "Snapshot has an empty API for service %v", record.key())
+			}
+		}
+	}
+	return nil
+}
+
+func sameStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// restoreCreatedAt - Keeps the registration time of a service registered from a snapshot within the pending change
+func (s *Service) restoreCreatedAt(createdAt time.Time) {
+	if !createdAt.IsZero() {
+		s.CreatedAt = createdAt
+	}
+}
+
+// restoreService - Sets the expiry, active profile and labels of the service of a snapshot
+func (tx *Tx) restoreService(serviceID string, record *ServiceRecord) error {
+	if _, err := tx.SetActiveProfile(serviceID, record.ActiveProfile); err != nil {
+		return err
+	}
+	if err := tx.SetServiceLabels(serviceID, record.Labels); err != nil {
+		return err
+	}
+	return tx.SetServiceExpiry(serviceID, record.ExpiresAt)
+}
+
+// validateRecordedAPI - Checks the API of a snapshot the way the registration payloads are checked,
+// snapshots come from files and imports that may have been edited by hand
+func validateRecordedAPI(api *API) error {
+	if api.URL == "" {
+		return NewError(ErrInvalidArgument, "url of an API is required")
+	}
+	if !api.APIVerb.IsValid() {
+		return NewError(ErrUnsupportedVerb, "HTTP Method %v not supported", api.APIVerb)
+	}
+	if api.APIResponse == nil {
+		return NewError(ErrInvalidArgument, "api_response of API %v is missing", api.URL)
+	}
+	return nil
+}
+
+// restoreAPI - Registers the API of a snapshot along with its expiry, invocation limit and labels
+func (tx *Tx) restoreAPI(serviceID string, api *API) error {
+	if err := validateRecordedAPI(api); err != nil {
+		return err
+	}
+	registered, err := tx.RegisterProfileAPI(serviceID, api.Profile, api.URL, api.Matchers, api.APIVerb, api.APIPayload, api.APIResponse, api.InvocationMode)
+	if err != nil {
+		return err
+	}
+	if err := tx.SetAPIExpiry(serviceID, registered.ID, api.ExpiresAt); err != nil {
+		return err
+	}
+	if err := tx.SetAPILabels(serviceID, registered.ID, api.Labels); err != nil {
+		return err
+	}
+	if !api.CreatedAt.IsZero() {
+		// Registered within this change, not published yet and hence safe to change in place
+		tx.services[serviceID].registeredAPIs[registered.ID].CreatedAt = api.CreatedAt
+	}
+	return tx.SetAPITimes(serviceID, registered.ID, api.Times)
+}
+
+// Restore - Replaces the content of the pending change with the services and APIs of the snapshot
+// Services and APIs go through the regular registration, hence validated and with their reverse proxies set up
+func (tx *Tx) Restore(snapshot *Snapshot) error {
+	if err := checkSnapshot(snapshot); err != nil {
+		return err
+	}
+	for serviceID := range tx.services {
+		tx.UnregisterService(serviceID)
+	}
+	for _, record := range snapshot.Services {
+		service, err := tx.registerService(record.Namespace, record.Name, record.Version, record.BaseURL, record.InvocationMode)
+		if err != nil {
+			return fmt.Errorf("Unable to restore service %v :: %w", record.key(), err)
+		}
+		service.restoreCreatedAt(record.CreatedAt)
+		if err := tx.restoreService(service.ID, &record); err != nil {
+			return err
+		}
+		for _, api := range record.APIs {
+			if err := tx.restoreAPI(service.ID, api); err != nil {
+				return fmt.Errorf("Unable to restore API %v of service %v :: %w", api.URL, service.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Restore - Atomically replaces everything registered with the content of the snapshot, nothing changes if it errs
+func (r *Registry) Restore(snapshot *Snapshot) error {
+	return r.mutate(func(tx *Tx) error {
+		return tx.Restore(snapshot)
+	})
+}
+
+// Merge - Adds the services and APIs of the snapshot to the ones registered within the pending change
+// A service already registered is merged into only if it has the same base_url and mode, an API already registered is a conflict.
+// All conflicts are reported together as an *ImportConflictError
+func (tx *Tx) Merge(snapshot *Snapshot) error {
+	if err := checkSnapshot(snapshot); err != nil {
+		return err
+	}
+	var conflicts []ImportConflict
+	merged := make(map[string]bool, len(snapshot.Services))
+	for _, record := range snapshot.Services {
+		serviceKey := record.key()
+		if merged[serviceKey] {
+			conflicts = append(conflicts, ImportConflict{serviceKey, "", "service declared more than once in the snapshot"})
+			continue
+		}
+		merged[serviceKey] = true
+		service, err := tx.GetServiceByID(serviceKey)
+		if err == nil {
+			mode := record.InvocationMode
+			if mode == nil {
+				mode = &defaultMode
+			}
+			if !sameStringPtr(service.BaseURL, record.BaseURL) || !sameStringPtr(service.InvocationMode, mode) {
+				conflicts = append(conflicts, ImportConflict{serviceKey, "", "service already registered with a different base_url or invocation_mode"})
+				continue
+			}
+		} else {
+			service, err = tx.registerService(record.Namespace, record.Name, record.Version, record.BaseURL, record.InvocationMode)
+			if err != nil {
+				return fmt.Errorf("Unable to import service %v :: %w", serviceKey, err)
+			}
+			service.restoreCreatedAt(record.CreatedAt)
+			if err := tx.restoreService(serviceKey, &record); err != nil {
+				return err
+			}
+		}
+		for _, api := range record.APIs {
+			apiID, err := RegistrationID(api.Profile, api.URL, api.Matchers, api.APIVerb, api.APIPayload)
+			if err != nil {
+				return fmt.Errorf("Unable to import API %v of service %v :: %w", api.URL, serviceKey, err)
+			}
+			if registered, OK := tx.services[serviceKey].registeredAPIs[apiID]; OK {
+				conflicts = append(conflicts, ImportConflict{serviceKey, registered.ID, fmt.Sprintf("%v already registered", registered)})
+				continue
+			}
+			if err := tx.restoreAPI(serviceKey, api); err != nil {
+				return fmt.Errorf("Unable to import API %v of service %v :: %w", api.URL, serviceKey, err)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return &ImportConflictError{conflicts}
+	}
+	return nil
+}
+
+// LoadSnapshot - Reads a snapshot from file, returns nil without error if the file does not exist
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read snapshot file %v :: %v", path, err.Error())
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("Unable to parse snapshot file %v :: %v", path, err.Error())
+	}
+	return &snapshot, nil
+}
+
+// SaveSnapshot - Writes the snapshot to a temporary file next to path and renames it over, so a crash never leaves a partial file
+func SaveSnapshot(path string, snapshot *Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
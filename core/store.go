@@ -0,0 +1,81 @@
+package core
+
+import "fmt"
+
+// StoreEventType - Represent the kind of change published by a Store
+type StoreEventType int
+
+const (
+	// ServiceRegistered - A service was added to the store
+	ServiceRegistered StoreEventType = iota
+	// ServiceUnregistered - A service was removed from the store along with all its APIs
+	ServiceUnregistered
+	// APIRegistered - An API was added to a service
+	APIRegistered
+	// APIUnregistered - An API was removed from a service
+	APIUnregistered
+	// ServiceUpdated - The base url or mode of a service changed
+	ServiceUpdated
+	// APIUpdated - The mocked response or mode of an API changed
+	APIUpdated
+	// ServiceExpired - A service was removed from the store along with all its APIs once its time to live elapsed
+	ServiceExpired
+	// APIExpired - An API was removed from a service once its time to live elapsed
+	APIExpired
+)
+
+var storeEventTypes = [...]string{
+	"service_registered",
+	"service_unregistered",
+	"api_registered",
+	"api_unregistered",
+	"service_updated",
+	"api_updated",
+	"service_expired",
+	"api_expired",
+}
+
+// String - string valueof the StoreEventType enum
+func (t StoreEventType) String() string { return storeEventTypes[t] }
+
+// StoreEvent - A single change published by a Store to its watchers
+type StoreEvent struct {
+	Type      StoreEventType
+	ServiceID string
+	// APIID - Empty for service level events
+	APIID string
+}
+
+// Store - Storage backend for the registered services and their APIs
+type Store interface {
+	ServiceRegistration
+	APIRegistration
+	UnregisterServiceByID(serviceID string) (*Service, error)
+	UnregisterAPI(serviceID, apiID string) (*API, error)
+	Snapshot() *Snapshot
+	Restore(snapshot *Snapshot) error
+	Update(change func(tx *Tx) error) error
+	Revisions(serviceID, apiID string) ([]Revision, error)
+	Watch(watcher func(event StoreEvent)) (unwatch func())
+	Subscribe(afterID uint64) *Subscription
+}
+
+// Store backends supported by NewStore
+const (
+	// MemoryStoreType - Keeps everything in process memory, lost on restart
+	MemoryStoreType = "memory"
+	// FileStoreType - Keeps everything in process memory and persists every change to a file
+	FileStoreType = "file"
+)
+
+// NewStore - Creates the store backend of the given type, path is only used by file backed stores
+func NewStore(storeType, path string) (Store, error) {
+	switch storeType {
+	case MemoryStoreType:
+		return NewRegistry(), nil
+	case FileStoreType:
+		return NewFileStore(path)
+	default:
+		return nil, fmt.Errorf("Store type %v not supported", storeType)
+	}
+}
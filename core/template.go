@@ -0,0 +1,197 @@
+package core
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// templateParamPattern - A path segment capturing the segment of the requested path at its position, e.g. {id}
+var templateParamPattern = regexp.MustCompile(`^\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// pathTemplate - API url whose path segments may be parameters, e.g. /users/{id}/orders/{orderId}
+// The query (if any) is not part of the template and is matched as any other
+type pathTemplate struct {
+	segments []string
+	// params - Name of the parameter of each segment, empty for the literal ones
+	params []string
+	query  string
+}
+
+// splitQuery - Splits the url into its path and query (without the '?')
+func splitQuery(url string) (string, string) {
+	if i := strings.Index(url, "?"); i >= 0 {
+		return url[:i], url[i+1:]
+	}
+	return url, ""
+}
+
+// IsPathTemplate - Whether the API url has parameters in its path
+func IsPathTemplate(url string) bool {
+	if IsURLPattern(url) {
+		return false
+	}
+	path, _ := splitQuery(url)
+	return strings.ContainsAny(path, "{}")
+}
+
+// parsePathTemplate - Parses the API url as a path template, nil if it has no parameters
+func parsePathTemplate(url string) (*pathTemplate, error) {
+	if !IsPathTemplate(url) {
+		return nil, nil
+	}
+	path, query := splitQuery(canonicalURL(url))
+	template := &pathTemplate{strings.Split(path, "/"), nil, query}
+	template.params = make([]string, len(template.segments))
+	for i, segment := range template.segments {
+		if !strings.ContainsAny(segment, "{}") {
+			continue
+		}
+		match := templateParamPattern.FindStringSubmatch(segment)
+		if match == nil {
+			return nil, NewError(ErrInvalidArgument, "Invalid path template %v, a parameter spans a whole segment and is named with letters, digits and '_', e.g. /users/{id}", url)
+		}
+		for _, param := range template.params {
+			if param == match[1] {
+				return nil, NewError(ErrInvalidArgument, "Invalid path template %v, parameter %v used more than once", url, param)
+			}
+		}
+		template.params[i] = match[1]
+	}
+	return template, nil
+}
+
+// match - Captures the parameters of the template out of the path, nil if the path does not match
+func (t *pathTemplate) match(path string) map[string]string {
+	segments := strings.Split(path, "/")
+	if len(segments) != len(t.segments) {
+		return nil
+	}
+	params := make(map[string]string)
+	for i, segment := range segments {
+		if t.params[i] == "" {
+			if segment != t.segments[i] {
+				return nil
+			}
+			continue
+		}
+		if segment == "" {
+			return nil
+		}
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		params[t.params[i]] = segment
+	}
+	return params
+}
+
+// shape - The template with its parameters left unnamed, templates of the same shape match the same urls
+func (t *pathTemplate) shape() string {
+	segments := make([]string, len(t.segments))
+	for i, segment := range t.segments {
+		if t.params[i] != "" {
+			segment = "{}"
+		}
+		segments[i] = segment
+	}
+	return strings.Join(segments, "/") + "?" + t.query
+}
+
+// precedes - Whether the template takes precedence over the other one of as many segments,
+// the first segment literal in one of them and a parameter in the other wins
+func (t *pathTemplate) precedes(other *pathTemplate) bool {
+	for i := range t.params {
+		if (t.params[i] == "") != (other.params[i] == "") {
+			return t.params[i] == ""
+		}
+	}
+	return false
+}
+
+// templateClash - The API registered with a template of the same shape as the one of the API, for the same verb, payload, matchers and profile
+func (s *Service) templateClash(api *API) *API {
+	if api.template == nil {
+		return nil
+	}
+	shape := api.template.shape()
+	for _, registered := range s.registeredAPIs {
+		if registered.template != nil && registered.APIVerb == api.APIVerb && registered.Profile == api.Profile &&
+			string(registered.idSeeds.PayloadSeed) == string(api.idSeeds.PayloadSeed) && sameMatchers(registered.Matchers, api.Matchers) &&
+			registered.template.shape() == shape {
+			return registered
+		}
+	}
+	return nil
+}
+
+// matchTemplateAPI - Matches the request against the APIs registered with a path template, the most literal template first
+func matchTemplateAPI(s *Service, req *APIRequest) (*APIMatch, error) {
+	templates := make(map[string]*pathTemplate)
+	for _, api := range s.registeredAPIs {
+		if api.template != nil && api.APIVerb == req.Verb {
+			templates[api.URL] = api.template
+		}
+	}
+	urls := make([]string, 0, len(templates))
+	for templateURL := range templates {
+		urls = append(urls, templateURL)
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		first, second := templates[urls[i]], templates[urls[j]]
+		if len(first.segments) != len(second.segments) {
+			// Never match the same urls
+			return len(first.segments) < len(second.segments)
+		}
+		if first.precedes(second) != second.precedes(first) {
+			return first.precedes(second)
+		}
+		return urls[i] < urls[j]
+	})
+	path, query := splitQuery(req.URL)
+	for _, templateURL := range urls {
+		params := templates[templateURL].match(path)
+		if params == nil {
+			continue
+		}
+		api, err := s.registeredAPI(templateURL, req, query == templates[templateURL].query)
+		if err != nil {
+			return nil, err
+		}
+		if api != nil {
+			return &APIMatch{api, params}, nil
+		}
+	}
+	return nil, nil
+}
+
+// FillPathParams - Copy of the value with the {name} placeholders of its strings replaced by the captured parameters
+func FillPathParams(value interface{}, params map[string]string) interface{} {
+	if len(params) == 0 {
+		return value
+	}
+	switch typed := value.(type) {
+	case string:
+		for name, param := range params {
+			typed = strings.Replace(typed, "{"+name+"}", param, -1)
+		}
+		return typed
+	case Payload:
+		return Payload(FillPathParams(map[string]interface{}(typed), params).(map[string]interface{}))
+	case map[string]interface{}:
+		filled := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			filled[key] = FillPathParams(item, params)
+		}
+		return filled
+	case []interface{}:
+		filled := make([]interface{}, len(typed))
+		for i, item := range typed {
+			filled[i] = FillPathParams(item, params)
+		}
+		return filled
+	default:
+		return value
+	}
+}
@@ -0,0 +1,120 @@
+package core
+
+import "fmt"
+
+// UpdateService - Replaces the base url and mode of a registered service within the pending change
+// The modes of the service and of all its APIs are validated again, the reverse proxy is rebuilt if the upstream changed
+func (tx *Tx) UpdateService(serviceID string, baseURL *string, mode *string) (*Service, error) {
+	service, err := tx.writableService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	// Validated on a copy so that the service is left as it was if it errs
+	candidate := *service
+	candidate.BaseURL = baseURL
+	candidate.InvocationMode = mode
+	serviceMode, err := candidate.validateServiceMode()
+	if err != nil {
+		return nil, err
+	}
+	candidate.InvocationMode = serviceMode
+	for _, api := range candidate.registeredAPIs {
+		if _, err := candidate.validateAPIMode(api.InvocationMode); err != nil {
+			return nil, fmt.Errorf("%v :: %w", api, err)
+		}
+	}
+	upstreamChanged := !sameStringPtr(service.BaseURL, candidate.BaseURL)
+	service.BaseURL = candidate.BaseURL
+	service.InvocationMode = candidate.InvocationMode
+	if service.ReverseProxy != nil && (upstreamChanged || !service.needsProxy()) {
+		tx.unproxied = append(tx.unproxied, service.ReverseProxy)
+		service.ReverseProxy = nil
+	}
+	if service.ReverseProxy == nil && service.needsProxy() {
+		service.ReverseProxy = NewServiceProxy(*service.BaseURL)
+	}
+	tx.record(ServiceUpdated, service.ID, "")
+	return service, nil
+}
+
+// UpdateAPI - Replaces the mocked response and mode of a registered API within the pending change
+// url, verb and request payload make up the API id and hence can not be updated
+func (tx *Tx) UpdateAPI(serviceID, apiID string, response *MockedResponse, mode *string) (*API, error) {
+	service, err := tx.writableService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := service.GetAPIByID(apiID); err != nil {
+		return nil, err
+	}
+	apiMode, err := service.validateAPIMode(mode)
+	if err != nil {
+		return nil, err
+	}
+	api, err := tx.replaceAPI(serviceID, apiID, func(api *API) bool {
+		api.APIResponse = response
+		api.InvocationMode = apiMode
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if service.ReverseProxy == nil && service.needsProxy() {
+		service.ReverseProxy = NewServiceProxy(*service.BaseURL)
+	}
+	return api, nil
+}
+
+// UpsertService - Registers the service or, if already registered, replaces its base url and mode keeping its APIs
+// Reports if the service got created, the service id is derived from name and version and hence stable across upserts
+func (tx *Tx) UpsertService(namespace, name, version string, baseURL *string, mode *string) (*Service, bool, error) {
+	serviceKey := getServiceKey(namespace, name, version)
+	if _, OK := tx.services[serviceKey]; OK {
+		service, err := tx.UpdateService(serviceKey, baseURL, mode)
+		return service, false, err
+	}
+	service, err := tx.registerService(namespace, name, version, baseURL, mode)
+	return service, err == nil, err
+}
+
+// UpsertAPI - Registers the API or, if already registered, replaces its mocked response and mode
+// Reports if the API got created, the API id is derived from url, matchers, verb and request payload and hence stable across upserts
+func (tx *Tx) UpsertAPI(serviceID, profile, url string, matchers *RequestMatchers, verb Verb, payload Payload, response *MockedResponse, mode *string) (*API, bool, error) {
+	service, err := tx.GetServiceByID(serviceID)
+	if err != nil {
+		return nil, false, err
+	}
+	apiID, err := RegistrationID(profile, url, matchers, verb, payload)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, OK := service.registeredAPIs[apiID]; OK {
+		api, err := tx.UpdateAPI(serviceID, apiID, response, mode)
+		return api, false, err
+	}
+	api, err := tx.RegisterProfileAPI(serviceID, profile, url, matchers, verb, payload, response, mode)
+	return api, err == nil, err
+}
+
+// ResetService - Removes the APIs of the service matching the selector within the pending change keeping the service registered,
+// reports how many were removed
+func (tx *Tx) ResetService(serviceID string, selector LabelSelector) (int, error) {
+	service, err := tx.writableService(serviceID)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for apiID, api := range service.registeredAPIs {
+		if !selector.Matches(api.Labels) {
+			continue
+		}
+		delete(service.registeredAPIs, apiID)
+		tx.record(APIUnregistered, service.ID, apiID)
+		removed++
+	}
+	if service.ReverseProxy != nil && !service.needsProxy() {
+		tx.unproxied = append(tx.unproxied, service.ReverseProxy)
+		service.ReverseProxy = nil
+	}
+	return removed, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/heckdevice/moxy/core"
+	"github.com/valyala/fasthttp"
+	"strconv"
+	"time"
+)
+
+const (
+	eventStreamType = "text/event-stream"
+	// lastEventIDHeader - Sent back by a reconnecting EventSource with the id of the last event it got
+	lastEventIDHeader = "Last-Event-ID"
+	// gapEvent - Tells the client some changes are missing from the stream and the mocks should be listed again
+	gapEvent = "gap"
+)
+
+// eventsKeepAlive - Interval of the comments sent over an idle event stream, so that gone clients get noticed
+const eventsKeepAlive = 15 * time.Second
+
+// closingEventStreams - Closed on shutdown to end the open event streams
+var closingEventStreams = make(chan struct{})
+
+// lastEventID - Id of the last change the client got, from the Last-Event-ID header or else the last_event_id query param
+func lastEventID(ctx *fasthttp.RequestCtx) (uint64, error) {
+	value := string(ctx.Request.Header.Peek(lastEventIDHeader))
+	if value == "" {
+		value = string(ctx.QueryArgs().Peek("last_event_id"))
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, core.NewError(core.ErrInvalidArgument, "Invalid last event id %v", value)
+	}
+	return id, nil
+}
+
+// writeEvent - Writes the change as a Server-Sent Event named after the change and flushes it
+func writeEvent(w *bufio.Writer, event core.ChangeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", event.ID, event.Change, data)
+	return w.Flush()
+}
+
+// streamEvents - Streams the changes to services and APIs as Server-Sent Events, resuming after the last event id given (if any).
+// A gap event is sent first if some of the changes to resume from are no longer kept
+func streamEvents(ctx *fasthttp.RequestCtx) {
+	afterID, err := lastEventID(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	subscription := store.Subscribe(afterID)
+	setContentType(ctx, eventStreamType)
+	// The connection is not reused once the stream ends, so that it does not hold a shutdown back
+	ctx.SetConnectionClose()
+	ctx.Response.Header.Set("Cache-Control", "no-cache")
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer subscription.Close()
+		if subscription.Gap {
+			fmt.Fprintf(w, "event: %v\ndata: {}\n\n", gapEvent)
+		}
+		for _, event := range subscription.Backlog {
+			if writeEvent(w, event) != nil {
+				return
+			}
+		}
+		if w.Flush() != nil {
+			return
+		}
+		ticker := time.NewTicker(eventsKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case event, OK := <-subscription.Events:
+				if !OK {
+					// Dropped for lagging behind, the client reconnects and resumes from the last event it got
+					return
+				}
+				if writeEvent(w, event) != nil {
+					return
+				}
+			case <-closingEventStreams:
+				return
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+}
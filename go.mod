@@ -8,4 +8,5 @@ require (
 	github.com/sirupsen/logrus v1.7.0
 	github.com/valyala/fasthttp v1.23.0
 	github.com/yeqown/fasthttp-reverse-proxy/v2 v2.1.4
+	gopkg.in/yaml.v3 v3.0.1
 )
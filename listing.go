@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/base64"
+	"github.com/heckdevice/moxy/core"
+	"github.com/valyala/fasthttp"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of the listing endpoints
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// ListPage - A page of a listing endpoint, NextCursor is to be passed as cursor to get the next page and is empty on the last one
+type ListPage struct {
+	Items      []interface{} `json:"items"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// listItem - An item of a listing along with the key it is sorted by, ties are broken by id
+type listItem struct {
+	key   string
+	id    string
+	value interface{}
+}
+
+// listQuery - Sorting, search and pagination params of a listing request
+// sort=field or sort=-field for descending order, q=substring, regex=pattern, limit=n, cursor=next_cursor of the previous page
+type listQuery struct {
+	sortBy     string
+	descending bool
+	search     string
+	pattern    *regexp.Regexp
+	limit      int
+	// after - Sort key and id of the last item of the previous page
+	after *listItem
+}
+
+// parseListQuery - Reads the listing params of the request, sortFields are the fields the listing can be sorted by
+func parseListQuery(ctx *fasthttp.RequestCtx, sortFields []string) (*listQuery, error) {
+	args := ctx.QueryArgs()
+	query := &listQuery{sortBy: sortFields[0], limit: defaultPageLimit, search: string(args.Peek("q"))}
+	if sortBy := string(args.Peek("sort")); sortBy != "" {
+		query.descending = strings.HasPrefix(sortBy, "-")
+		query.sortBy = strings.TrimPrefix(sortBy, "-")
+		supported := false
+		for _, field := range sortFields {
+			supported = supported || field == query.sortBy
+		}
+		if !supported {
+			return nil, core.NewError(core.ErrInvalidArgument, "Sorting by %v not supported, use one of %v", query.sortBy, strings.Join(sortFields, ", "))
+		}
+	}
+	if pattern := string(args.Peek("regex")); pattern != "" {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, core.NewError(core.ErrInvalidArgument, "Invalid regex %v :: %v", pattern, err.Error())
+		}
+		query.pattern = compiled
+	}
+	if limit := string(args.Peek("limit")); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			return nil, core.NewError(core.ErrInvalidArgument, "limit should be between 1 and %v", maxPageLimit)
+		}
+		query.limit = parsed
+	}
+	if cursor := string(args.Peek("cursor")); cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		parts := strings.SplitN(string(decoded), "\x00", 2)
+		if err != nil || len(parts) != 2 {
+			return nil, core.NewError(core.ErrInvalidArgument, "Invalid cursor %v", cursor)
+		}
+		query.after = &listItem{key: parts[0], id: parts[1]}
+	}
+	return query, nil
+}
+
+// matches - Checks the text meets the substring and regex search of the query
+func (query *listQuery) matches(text string) bool {
+	if query.search != "" && !strings.Contains(text, query.search) {
+		return false
+	}
+	return query.pattern == nil || query.pattern.MatchString(text)
+}
+
+// sortTime - Sort key of a time, fixed width so that keys sort as the times do
+func sortTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// before - Checks if a comes before b in the sort order of the query
+func (query *listQuery) before(a, b *listItem) bool {
+	less := a.key < b.key || (a.key == b.key && a.id < b.id)
+	if query.descending {
+		return !less && (a.key != b.key || a.id != b.id)
+	}
+	return less
+}
+
+// page - Sorts the matching items and cuts the page following the cursor out of them
+func (query *listQuery) page(items []listItem) *ListPage {
+	sort.Slice(items, func(i, j int) bool { return query.before(&items[i], &items[j]) })
+	start := 0
+	if query.after != nil {
+		start = sort.Search(len(items), func(i int) bool { return query.before(query.after, &items[i]) })
+	}
+	end := start + query.limit
+	if end > len(items) {
+		end = len(items)
+	}
+	page := &ListPage{Items: make([]interface{}, 0, end-start), Total: len(items)}
+	for _, item := range items[start:end] {
+		page.Items = append(page.Items, item.value)
+	}
+	if end < len(items) {
+		last := items[end-1]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(last.key + "\x00" + last.id))
+	}
+	return page
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/fasthttp/router"
 	"github.com/go-playground/validator/v10"
@@ -9,7 +11,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
 	"os"
+	"os/signal"
+	"reflect"
 	"strings"
+	"syscall"
+	"time"
 )
 
 const (
@@ -20,6 +26,7 @@ var (
 	apiPathParams = [...]string{
 		"serviceID",
 		"apiID",
+		"namespace",
 	}
 )
 
@@ -34,14 +41,53 @@ const (
 	SERVICEID PathParams = iota
 	// APIID - apiID path param
 	APIID
+	// NAMESPACE - namespace path param
+	NAMESPACE
 )
 
+// namespaceHeader - Request header selecting the namespace the mocks of a request are served from
+const namespaceHeader = "X-Moxy-Namespace"
+
+// Request headers annotating the revisions recorded by the admin APIs changing services and APIs
+const (
+	authorHeader  = "X-Moxy-Author"
+	commentHeader = "X-Moxy-Comment"
+)
+
+// namespaceIDPrefix - Path prefix of the mocks of the services registered within a namespace, /ns/{namespace}/{serviceID}/...
+const namespaceIDPrefix = "/ns/"
+
 var (
 	info     = map[string]interface{}{"ver": "1.0", "name": "moxy", "description": "Reverse Proxy with inbuilt mocking feature"}
-	r        = router.New()
+	r        *router.Router
 	validate = validator.New()
+	store    core.Store
+	args     = &CLIArgs{}
 )
 
+// CLIArgs - Command line arguments for the main function
+type CLIArgs struct {
+	storeType    string
+	storeFile    string
+	snapshotFile string
+	mocksDir     string
+	mocksPoll    time.Duration
+	reapEvery    time.Duration
+}
+
+func init() {
+	// Report validation errors with the json field names clients send
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	})
+	flag.StringVar(&args.storeType, "store", core.MemoryStoreType, "registry storage backend, one of memory|file")
+	flag.StringVar(&args.storeFile, "store-file", "moxy-store.json", "file persisting the registry when -store=file")
+	flag.StringVar(&args.mocksDir, "mocks-dir", "", "directory of JSON/YAML mock definition files, one service per file, registered at startup")
+	flag.DurationVar(&args.mocksPoll, "mocks-poll", 2*time.Second, "interval the mocks directory is polled for changes at, 0 disables hot reload")
+	flag.DurationVar(&args.reapEvery, "reap-interval", time.Second, "interval expired services and APIs are removed at, 0 leaves them registered (they still stop serving)")
+	flag.StringVar(&args.snapshotFile, "snapshot-file", "", "file the registry is snapshotted to on change and on shutdown, and restored from at startup")
+}
+
 func initLogger() {
 	log.SetOutput(os.Stdout)
 	log.SetOutput(os.Stderr)
@@ -57,7 +103,7 @@ func writeJSONResponse(ctx *fasthttp.RequestCtx, data interface{}, responseCode
 	setContentType(ctx, jsontype)
 	resp, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
 		return
 	}
 	if responseCode != nil {
@@ -66,8 +112,88 @@ func writeJSONResponse(ctx *fasthttp.RequestCtx, data interface{}, responseCode
 	ctx.Write(resp)
 }
 
+// ErrorResponse - JSON body of a failed admin or mock API call
+/*
+ {
+  "code":"not_found",
+  "message":"Service with id=google.1.0 is not registered",
+  "details":null
+ }
+*/
+type ErrorResponse struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Codes of ErrorResponse
+const (
+	notFoundCode          = "not_found"
+	alreadyRegisteredCode = "already_registered"
+	invalidModeCode       = "invalid_mode"
+	unsupportedVerbCode   = "unsupported_verb"
+	invalidArgumentCode   = "invalid_argument"
+	bulkRejectedCode      = "bulk_rejected"
+	internalCode          = "internal"
+)
+
+// errorKinds - Status and code each kind of core error is reported with, in lookup order
+var errorKinds = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{core.ErrNotFound, fasthttp.StatusNotFound, notFoundCode},
+	{core.ErrAlreadyRegistered, fasthttp.StatusConflict, alreadyRegisteredCode},
+	{core.ErrInvalidArgument, fasthttp.StatusBadRequest, invalidArgumentCode},
+	{core.ErrInvalidMode, fasthttp.StatusUnprocessableEntity, invalidModeCode},
+	{core.ErrUnsupportedVerb, fasthttp.StatusUnprocessableEntity, unsupportedVerbCode},
+}
+
+func writeError(ctx *fasthttp.RequestCtx, status int, code, msg string, details interface{}) {
+	writeJSONResponse(ctx, &ErrorResponse{code, msg, details}, &status)
+}
+
+// handleError - Reports the error with the status and code of its kind, errors of no known kind are internal errors
+func handleError(ctx *fasthttp.RequestCtx, err error) {
+	var details interface{}
+	var conflictErr *core.ImportConflictError
+	if errors.As(err, &conflictErr) {
+		details = conflictErr.Conflicts
+	}
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.kind) {
+			writeError(ctx, kind.status, kind.code, err.Error(), details)
+			return
+		}
+	}
+	handleInternalError(ctx, err.Error())
+}
+
+func handleBadRequest(ctx *fasthttp.RequestCtx, msg string) {
+	writeError(ctx, fasthttp.StatusBadRequest, invalidArgumentCode, msg, nil)
+}
+
+// handleValidationError - Reports a payload failing validation along with the offending fields
+func handleValidationError(ctx *fasthttp.RequestCtx, msg string, err error) {
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		handleBadRequest(ctx, fmt.Sprintf("%v :  %v", msg, err.Error()))
+		return
+	}
+	fields := make([]map[string]string, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		fields = append(fields, map[string]string{"field": fieldErr.Field(), "validation": fieldErr.Tag()})
+	}
+	writeError(ctx, fasthttp.StatusBadRequest, invalidArgumentCode, fmt.Sprintf("%v :  %v", msg, err.Error()), fields)
+}
+
 func handleInternalError(ctx *fasthttp.RequestCtx, msg string) {
-	ctx.Error(msg, fasthttp.StatusInternalServerError)
+	writeError(ctx, fasthttp.StatusInternalServerError, internalCode, msg, nil)
+}
+
+func handleNotFound(ctx *fasthttp.RequestCtx, msg string) {
+	writeError(ctx, fasthttp.StatusNotFound, notFoundCode, msg, nil)
 }
 
 func defaultHandler(ctx *fasthttp.RequestCtx) {
@@ -81,9 +207,16 @@ func infoHandler(ctx *fasthttp.RequestCtx) {
 func parseAPIUrl(requestPath string) (*string, *string, error) {
 	splitPath := strings.SplitAfter(requestPath, "/")
 	if len(splitPath) < 3 {
-		return nil, nil, fmt.Errorf("Invalid API Configuration. Configure path should in format /{serviceID}/{apiURL} or /{serviceID}/")
+		return nil, nil, core.NewError(core.ErrInvalidArgument, "Invalid API Configuration. Configure path should in format /{serviceID}/{apiURL} or /{serviceID}/")
 	}
 	serviceID := strings.Split(splitPath[1], "/")[0]
+	if strings.HasPrefix(requestPath, namespaceIDPrefix) {
+		// Namespaced service ids span three segments, ns/{namespace}/{serviceID}
+		if len(splitPath) < 5 {
+			return nil, nil, core.NewError(core.ErrInvalidArgument, "Invalid API Configuration. Configure path should in format /ns/{namespace}/{serviceID}/{apiURL} or /ns/{namespace}/{serviceID}/")
+		}
+		serviceID = strings.Join(splitPath[1:3], "") + strings.Split(splitPath[3], "/")[0]
+	}
 	apiURL := strings.TrimPrefix(requestPath, fmt.Sprintf("/%v", serviceID))
 	log.Info(fmt.Sprintf("Parsed Path Url - serviceID=%v, apiUrl=%v", serviceID, apiURL))
 	return &serviceID, &apiURL, nil
@@ -101,7 +234,7 @@ func fetchAPIInvocationDetails(ctx *fasthttp.RequestCtx) (*string, *MockableRequ
 		var req map[string]interface{}
 		err := json.Unmarshal(bodyBytes, &req)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, core.NewError(core.ErrInvalidArgument, "Request body should be a json object :: %v", err.Error())
 		}
 		mockAPI.RequestPayload = req
 	}
@@ -112,11 +245,31 @@ func fetchAPIInvocationDetails(ctx *fasthttp.RequestCtx) (*string, *MockableRequ
 func proxyTheRequest(ctx *fasthttp.RequestCtx, service *core.Service, requestURI string) {
 	serviceProxy := service.ReverseProxy
 	ctx.Request.SetRequestURI(requestURI)
-	if serviceProxy != nil {
-		serviceProxy.ServeHTTP(ctx)
-	} else {
+	if serviceProxy == nil {
 		handleInternalError(ctx, "Service reverse proxy is not properly initialized")
+		return
 	}
+	if err := serviceProxy.ServeHTTP(ctx); err != nil {
+		handleError(ctx, err)
+	}
+}
+
+// requestCookies - Values of the request cookies by name
+func requestCookies(ctx *fasthttp.RequestCtx) map[string]string {
+	cookies := make(map[string]string)
+	ctx.Request.Header.VisitAllCookie(func(key, value []byte) {
+		cookies[string(key)] = string(value)
+	})
+	return cookies
+}
+
+// requestHeaders - Values of the request headers by name
+func requestHeaders(ctx *fasthttp.RequestCtx) map[string][]string {
+	headers := make(map[string][]string)
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		headers[string(key)] = append(headers[string(key)], string(value))
+	})
+	return headers
 }
 
 func bigFatHandler(ctx *fasthttp.RequestCtx) {
@@ -138,36 +291,48 @@ func bigFatHandler(ctx *fasthttp.RequestCtx) {
 	log.Info(fmt.Sprintf("Resolving the API for path  %s", ctx.RequestURI()))
 	serviceID, apiDetails, err := fetchAPIInvocationDetails(ctx)
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleError(ctx, err)
 		return
 	}
 	log.Info(fmt.Sprintf("Mock request mapped : ServiceID=%v, APIDetails=%v", *serviceID, *apiDetails))
-	service, err := core.GetServiceByID(*serviceID)
+	service, err := store.GetServiceByID(*serviceID)
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleNotFound(ctx, err.Error())
+		return
+	}
+	if !isServiceRouted(service) {
+		handleNotFound(ctx, fmt.Sprintf("Service with id=%v has no mocks registered", service.ID))
+		return
+	}
+	// Expired mocks stop serving right away, even if the reaper did not remove them yet
+	if service.IsExpired(time.Now()) {
+		handleNotFound(ctx, fmt.Sprintf("Service with id=%v expired", service.ID))
 		return
 	}
 	verb, err := core.ResolveVerb(apiDetails.Method)
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleError(ctx, err)
 		return
 	}
 	var reqAsserted map[string]interface{} = nil
 	if apiDetails.RequestPayload != nil {
 		typedPayload, OK := apiDetails.RequestPayload.(map[string]interface{})
 		if !OK {
-			handleInternalError(ctx, "RequestPayload should be of json type")
+			handleBadRequest(ctx, "RequestPayload should be of json type")
 			return
 		}
 		reqAsserted = typedPayload
 	}
-	log.Info(fmt.Sprintf("API Resolved, generatin APIID using Url=%v, Verb=%v, Payload=%v", apiDetails.APIURL, verb, reqAsserted))
-	apiID, _, err := core.GenerateAPIID(apiDetails.APIURL, verb, reqAsserted)
-	if err != nil {
-		handleInternalError(ctx, err.Error())
-		return
+	log.Info(fmt.Sprintf("API Resolved, matching Url=%v, Verb=%v, Payload=%v", apiDetails.APIURL, verb, reqAsserted))
+	var api *core.API
+	// Expired APIs and the ones done serving their times are skipped, the next API in line serves instead
+	match, err := service.ServeAPI(&core.APIRequest{URL: apiDetails.APIURL, Verb: verb, Payload: reqAsserted, Headers: requestHeaders(ctx), Cookies: requestCookies(ctx)})
+	if err == nil {
+		api = match.API
+		if len(match.Params) > 0 {
+			log.Info(fmt.Sprintf("Path template matched : APIID=%v, Template=%v, Params=%v", api.ID, api.URL, match.Params))
+		}
 	}
-	api, err := service.GetAPIByID(*apiID)
 	//TODO Allow pass through/proxy for :
 	// 1.  A non-registered api when service allows pass through (api==nil || err!=nil) or
 	// 2.  A registered pass through api (second check)
@@ -175,7 +340,7 @@ func bigFatHandler(ctx *fasthttp.RequestCtx) {
 	//non-registered api
 	if err != nil {
 		if !service.IsPassThroughAllowed() {
-			handleInternalError(ctx, err.Error())
+			handleError(ctx, err)
 			return
 		}
 		proxyTheRequest(ctx, service, apiDetails.APIURL)
@@ -185,7 +350,7 @@ func bigFatHandler(ctx *fasthttp.RequestCtx) {
 		proxyTheRequest(ctx, service, apiDetails.APIURL)
 		return
 	}
-	writeJSONResponse(ctx, api.APIResponse.ResponsePayload, &api.APIResponse.ResponseCode)
+	writeJSONResponse(ctx, core.FillPathParams(api.APIResponse.ResponsePayload, match.Params), &api.APIResponse.ResponseCode)
 }
 
 // MockableRequest - A valid API request payload that can be registered as mock
@@ -196,34 +361,166 @@ type MockableRequest struct {
 	ResponsePayload interface{} `json:"response_payload"`
 	ResponseCode    int         `json:"response_code"`
 	InvocationMode  *string     `json:"invocation_mode"`
+	// TTL - Optional time to live of the API, e.g. 5m, it is removed once elapsed. Exclusive with ExpiresAt
+	TTL       string     `json:"ttl,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Times - Optional number of requests the API serves, afterwards it is treated as unregistered
+	Times *int `json:"times,omitempty"`
+	// Profile - Optional profile the API serves in, untagged APIs serve in all profiles
+	Profile string `json:"profile,omitempty"`
+	// Matchers - Optional conditions on the request on top of api_url, method and request_payload
+	Matchers *core.RequestMatchers `json:"matchers,omitempty"`
+	Labels   core.Labels           `json:"labels,omitempty"`
+}
+
+// configure - Sets the expiry, invocation limit and labels of the registered API within the transaction
+func (req *MockableRequest) configure(tx *core.Tx, serviceID, apiID string, expiresAt *time.Time) error {
+	if err := tx.SetAPIExpiry(serviceID, apiID, expiresAt); err != nil {
+		return err
+	}
+	if err := tx.SetAPILabels(serviceID, apiID, req.Labels); err != nil {
+		return err
+	}
+	return tx.SetAPITimes(serviceID, apiID, req.Times)
+}
+
+// APIStatus - A registered API along with its runtime state
+type APIStatus struct {
+	*core.API
+	// Remaining - Requests the API is still to serve when registered with times
+	Remaining *int `json:"remaining,omitempty"`
+}
+
+func newAPIStatus(api *core.API) *APIStatus {
+	return &APIStatus{api, api.Remaining()}
+}
+
+// MockableService - A valid service registration payload, optionally with a time to live (ttl) or an expires_at
+/*
+ {
+  "name":"google",
+  "version":"1.0",
+  "ttl":"10m"
+ }
+*/
+type MockableService struct {
+	core.Service
+	TTL string `json:"ttl,omitempty"`
+}
+
+// resolveExpiry - When a registration given a ttl or an expires_at is to expire, nil if neither is given
+func resolveExpiry(ttl string, expiresAt *time.Time) (*time.Time, error) {
+	if ttl == "" {
+		return expiresAt, nil
+	}
+	if expiresAt != nil {
+		return nil, core.NewError(core.ErrInvalidArgument, "ttl and expires_at can not be both given")
+	}
+	duration, err := time.ParseDuration(ttl)
+	if err != nil || duration <= 0 {
+		return nil, core.NewError(core.ErrInvalidArgument, "ttl should be a positive duration, e.g. 90s or 5m")
+	}
+	at := time.Now().UTC().Add(duration)
+	return &at, nil
+}
+
+// resolve - Resolves the verb, request payload and mocked response the request is to be registered with
+func (req *MockableRequest) resolve() (core.Verb, core.Payload, *core.MockedResponse, error) {
+	verb, err := core.ResolveVerb(req.Method)
+	if err != nil {
+		return verb, nil, nil, err
+	}
+	respAsserted, OK := req.ResponsePayload.(map[string]interface{})
+	if !OK {
+		return verb, nil, nil, core.NewError(core.ErrInvalidArgument, "response_payload should be of json type")
+	}
+	mockedResp := core.MockedResponse{ResponseCode: req.ResponseCode, ResponsePayload: respAsserted}
+	reqAsserted, OK := req.RequestPayload.(map[string]interface{})
+	if !OK {
+		return verb, nil, nil, core.NewError(core.ErrInvalidArgument, "request_payload should be of json type")
+	}
+	return verb, reqAsserted, &mockedResp, nil
 }
 
 func serviceRegistration(ctx *fasthttp.RequestCtx) {
 	reqPayload := ctx.Request.Body()
-	var req core.Service
+	var req MockableService
 	err := json.Unmarshal(reqPayload, &req)
 	if err != nil {
-		handleInternalError(ctx, "Unable to parse request payload")
+		handleBadRequest(ctx, "Unable to parse request payload")
 		return
 	}
 	err = validate.Struct(&req)
 	if err != nil {
-		handleInternalError(ctx, fmt.Sprintf("Invalid Service registration payload :  %v", err.Error()))
+		handleValidationError(ctx, "Invalid Service registration payload", err)
 		return
 	}
+	expiresAt, err := resolveExpiry(req.TTL, req.ExpiresAt)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	// The namespace comes from the route only, the plain /v1 route registers within the default namespace
+	req.Namespace = namespaceFromCtx(ctx)
 	log.Info(fmt.Sprintf("Service Registration request %v", req))
-	service, err := core.RegisterService(req.Name, req.Version, req.BaseURL, req.InvocationMode)
+	if ctx.IsPut() {
+		serviceUpsert(ctx, &req.Service, expiresAt)
+		return
+	}
+	var service *core.Service
+	err = updateStore(ctx, func(tx *core.Tx) error {
+		var err error
+		service, err = tx.RegisterService(req.Namespace, req.Name, req.Version, req.BaseURL, req.InvocationMode)
+		if err != nil {
+			return err
+		}
+		if err = tx.SetServiceLabels(service.ID, req.Labels); err != nil {
+			return err
+		}
+		return tx.SetServiceExpiry(service.ID, expiresAt)
+	})
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleError(ctx, err)
 		return
 	}
 	if service.IsPassThroughAllowed() {
-		serviceBaseURL := fmt.Sprintf("/%s/{mockedPath:*}", service.ID)
-		r.ANY(serviceBaseURL, bigFatHandler)
+		registerServiceRoute(service.ID)
 	}
 	writeJSONResponse(ctx, service, nil)
 }
 
+// serviceUpsert - Registers the service or replaces the base_url and invocation_mode of the registered one,
+// responds 201 if the service got created and 200 if it got updated. The expiry is replaced as well, none if not given
+func serviceUpsert(ctx *fasthttp.RequestCtx, req *core.Service, expiresAt *time.Time) {
+	var service *core.Service
+	created := false
+	err := updateStore(ctx, func(tx *core.Tx) error {
+		var err error
+		service, created, err = tx.UpsertService(req.Namespace, req.Name, req.Version, req.BaseURL, req.InvocationMode)
+		if err != nil {
+			return err
+		}
+		if err = tx.SetServiceLabels(service.ID, req.Labels); err != nil {
+			return err
+		}
+		return tx.SetServiceExpiry(service.ID, expiresAt)
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	registerServiceRoute(service.ID)
+	writeJSONResponse(ctx, service, upsertResponseCode(created))
+}
+
+func upsertResponseCode(created bool) *int {
+	responseCode := fasthttp.StatusOK
+	if created {
+		responseCode = fasthttp.StatusCreated
+	}
+	return &responseCode
+}
+
 // Mandatory parameter in body
 // API - Service URI to mock, omit the actual service name just provide the API uri/path that is to be mocked
 // Method - Http Method supported by API - For each variation of HTTP method a separate registerService is to be called
@@ -244,38 +541,52 @@ func apiRegistration(ctx *fasthttp.RequestCtx) {
 	var req MockableRequest
 	err := json.Unmarshal(ctx.Request.Body(), &req)
 	if err != nil {
-		handleInternalError(ctx, "Unable to parse request payload")
+		handleBadRequest(ctx, "Unable to parse request payload")
 		return
 	}
 	err = validate.Struct(&req)
 	if err != nil {
-		handleInternalError(ctx, fmt.Sprintf("Invalid API registration payload :  %v", err.Error()))
+		handleValidationError(ctx, "Invalid API registration payload", err)
 		return
 	}
 	service, err := getServiceFromCtx(ctx)
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleError(ctx, err)
 		return
 	}
-	verb, err := core.ResolveVerb(req.Method)
+	verb, reqAsserted, mockedResp, err := req.resolve()
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleError(ctx, err)
 		return
 	}
-	respAsserted, OK := req.ResponsePayload.(map[string]interface{})
-	if !OK {
-		handleInternalError(ctx, "response_payload should be of json type")
+	expiresAt, err := resolveExpiry(req.TTL, req.ExpiresAt)
+	if err != nil {
+		handleError(ctx, err)
 		return
 	}
-	mockedResp := core.MockedResponse{ResponseCode: req.ResponseCode, ResponsePayload: respAsserted}
-	reqAsserted, OK := req.RequestPayload.(map[string]interface{})
-	if !OK {
-		handleInternalError(ctx, "request_payload should be of json type")
+	if ctx.IsPut() {
+		apiUpsert(ctx, service.ID, &req, verb, reqAsserted, mockedResp, expiresAt)
 		return
 	}
-	api, err := service.RegisterAPI(req.APIURL, verb, reqAsserted, &mockedResp, req.InvocationMode)
+	var api *core.API
+	err = updateStore(ctx, func(tx *core.Tx) error {
+		var err error
+		api, err = tx.RegisterProfileAPI(service.ID, req.Profile, req.APIURL, req.Matchers, verb, reqAsserted, mockedResp, req.InvocationMode)
+		if err != nil {
+			return err
+		}
+		if err = req.configure(tx, service.ID, api.ID, expiresAt); err != nil {
+			return err
+		}
+		service, err = tx.GetServiceByID(service.ID)
+		if err != nil {
+			return err
+		}
+		api, err = service.GetAPIByID(api.ID)
+		return err
+	})
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleError(ctx, err)
 		return
 	}
 	log.Info(fmt.Sprintf("API configured as mock = %v %v", req.Method, api.SelfURL))
@@ -283,34 +594,109 @@ func apiRegistration(ctx *fasthttp.RequestCtx) {
 	// This is the first API registered for this service
 	// hence we beed to register this route
 	if service.RoutesRegistered() == 1 && !service.IsPassThroughAllowed() {
-		serviceBaseURL := fmt.Sprintf("/%s/{mockedPath:*}", service.ID)
-		r.ANY(serviceBaseURL, bigFatHandler)
+		registerServiceRoute(service.ID)
 	}
 	writeJSONResponse(ctx, api, nil)
 }
 
+// apiUpsert - Registers the API or replaces the mocked response and invocation_mode of the registered one,
+// responds 201 if the API got created and 200 if it got updated. The expiry is replaced as well, none if not given
+func apiUpsert(ctx *fasthttp.RequestCtx, serviceID string, req *MockableRequest, verb core.Verb, reqAsserted core.Payload, mockedResp *core.MockedResponse, expiresAt *time.Time) {
+	var api *core.API
+	created := false
+	err := updateStore(ctx, func(tx *core.Tx) error {
+		var err error
+		api, created, err = tx.UpsertAPI(serviceID, req.Profile, req.APIURL, req.Matchers, verb, reqAsserted, mockedResp, req.InvocationMode)
+		if err != nil {
+			return err
+		}
+		if err = req.configure(tx, serviceID, api.ID, expiresAt); err != nil {
+			return err
+		}
+		service, err := tx.GetServiceByID(serviceID)
+		if err != nil {
+			return err
+		}
+		api, err = service.GetAPIByID(api.ID)
+		return err
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	log.Info(fmt.Sprintf("API upserted as mock = %v %v", req.Method, api.SelfURL))
+	registerServiceRoute(serviceID)
+	writeJSONResponse(ctx, api, upsertResponseCode(created))
+}
+
+// namespaceFromCtx - Namespace of the admin route, the default namespace for the routes outside /v1/ns/{namespace}
+func namespaceFromCtx(ctx *fasthttp.RequestCtx) string {
+	namespace := ctx.UserValue(NAMESPACE.String())
+	if namespace == nil {
+		return core.DefaultNamespace
+	}
+	return fmt.Sprintf("%v", namespace)
+}
+
+// serviceIDFromCtx - Full id of the service of the admin route, within the namespace of the route
+func serviceIDFromCtx(ctx *fasthttp.RequestCtx) string {
+	return core.NamespacedServiceID(namespaceFromCtx(ctx), fmt.Sprintf("%v", ctx.UserValue(SERVICEID.String())))
+}
+
+// updateStore - Applies the change to the store with its revisions annotated by the author and comment headers of the request
+func updateStore(ctx *fasthttp.RequestCtx, change func(tx *core.Tx) error) error {
+	return store.Update(func(tx *core.Tx) error {
+		tx.Annotate(string(ctx.Request.Header.Peek(authorHeader)), string(ctx.Request.Header.Peek(commentHeader)))
+		return change(tx)
+	})
+}
+
 func getServiceFromCtx(ctx *fasthttp.RequestCtx) (*core.Service, error) {
-	serviceID := ctx.UserValue(SERVICEID.String())
-	return core.GetServiceByID(fmt.Sprintf("%v", serviceID))
+	return store.GetServiceByID(serviceIDFromCtx(ctx))
 }
 func getService(ctx *fasthttp.RequestCtx) {
 	service, err := getServiceFromCtx(ctx)
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleError(ctx, err)
 		return
 	}
 	writeJSONResponse(ctx, service, nil)
 }
 
+// selectorFromCtx - Label selector of the selector query param, matches everything if not given
+func selectorFromCtx(ctx *fasthttp.RequestCtx) (core.LabelSelector, error) {
+	return core.ParseLabelSelector(string(ctx.QueryArgs().Peek("selector")))
+}
+
 func getAllServices(ctx *fasthttp.RequestCtx) {
-	registeredServices := core.GetRegisteredServices()
-	writeJSONResponse(ctx, registeredServices, nil)
+	selector, err := selectorFromCtx(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	query, err := parseListQuery(ctx, []string{"id", "created"})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	registeredServices := core.NamespaceServices(store.GetRegisteredServices(), namespaceFromCtx(ctx))
+	items := make([]listItem, 0, len(registeredServices))
+	for serviceID, service := range core.SelectServices(registeredServices, selector) {
+		if !query.matches(serviceID) {
+			continue
+		}
+		key := serviceID
+		if query.sortBy == "created" {
+			key = sortTime(service.CreatedAt)
+		}
+		items = append(items, listItem{key, serviceID, service})
+	}
+	writeJSONResponse(ctx, query.page(items), nil)
 }
 
 func getAPIFromCtx(ctx *fasthttp.RequestCtx) (*core.API, error) {
 	service, err := getServiceFromCtx(ctx)
 	if err != nil {
-		handleInternalError(ctx, err.Error())
 		return nil, err
 	}
 	apiID := ctx.UserValue(APIID.String())
@@ -320,38 +706,595 @@ func getAPIFromCtx(ctx *fasthttp.RequestCtx) (*core.API, error) {
 func getAllAPIs(ctx *fasthttp.RequestCtx) {
 	service, err := getServiceFromCtx(ctx)
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleError(ctx, err)
+		return
+	}
+	selector, err := selectorFromCtx(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	query, err := parseListQuery(ctx, []string{"url", "verb", "created"})
+	if err != nil {
+		handleError(ctx, err)
 		return
 	}
-	writeJSONResponse(ctx, service.GetRegisteredAPIs(), nil)
+	apis := core.SelectAPIs(service.GetRegisteredAPIs(), selector)
+	items := make([]listItem, 0, len(apis))
+	for apiID, api := range apis {
+		if !query.matches(api.URL) {
+			continue
+		}
+		key := api.URL
+		switch query.sortBy {
+		case "verb":
+			key = api.APIVerb.String()
+		case "created":
+			key = sortTime(api.CreatedAt)
+		}
+		items = append(items, listItem{key, apiID, newAPIStatus(api)})
+	}
+	writeJSONResponse(ctx, query.page(items), nil)
 }
 
 func getAPI(ctx *fasthttp.RequestCtx) {
 	api, err := getAPIFromCtx(ctx)
 	if err != nil {
-		handleInternalError(ctx, err.Error())
+		handleError(ctx, err)
+		return
+	}
+	writeJSONResponse(ctx, newAPIStatus(api), nil)
+}
+
+// ServiceChange - Payload to update a registered service, with PATCH omitted fields are left as they are
+type ServiceChange struct {
+	BaseURL        *string `json:"base_url"`
+	InvocationMode *string `json:"invocation_mode"`
+}
+
+// APIChange - Payload to update a registered API, with PATCH omitted fields are left as they are
+/*
+ {
+  "response_payload":{},
+  "response_code":200,
+  "invocation_mode":"mock"
+ }
+*/
+type APIChange struct {
+	ResponsePayload interface{} `json:"response_payload"`
+	ResponseCode    *int        `json:"response_code"`
+	InvocationMode  *string     `json:"invocation_mode"`
+}
+
+// updateService - PUT replaces the base_url and invocation_mode of the service, PATCH only the ones present in the payload
+func updateService(ctx *fasthttp.RequestCtx) {
+	var req ServiceChange
+	err := json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		handleBadRequest(ctx, "Unable to parse request payload")
+		return
+	}
+	serviceID := serviceIDFromCtx(ctx)
+	var service *core.Service
+	err = updateStore(ctx, func(tx *core.Tx) error {
+		registered, err := tx.GetServiceByID(serviceID)
+		if err != nil {
+			return err
+		}
+		if ctx.IsPatch() {
+			if req.BaseURL == nil {
+				req.BaseURL = registered.BaseURL
+			}
+			if req.InvocationMode == nil {
+				req.InvocationMode = registered.InvocationMode
+			}
+		}
+		service, err = tx.UpdateService(serviceID, req.BaseURL, req.InvocationMode)
+		return err
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	log.Info(fmt.Sprintf("Service updated %v", service))
+	registerServiceRoute(service.ID)
+	writeJSONResponse(ctx, service, nil)
+}
+
+// updateAPI - PUT replaces the mocked response and invocation_mode of the API, PATCH only the ones present in the payload
+func updateAPI(ctx *fasthttp.RequestCtx) {
+	var req APIChange
+	err := json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		handleBadRequest(ctx, "Unable to parse request payload")
 		return
 	}
+	var respAsserted map[string]interface{}
+	if req.ResponsePayload != nil || !ctx.IsPatch() {
+		var OK bool
+		respAsserted, OK = req.ResponsePayload.(map[string]interface{})
+		if !OK {
+			handleBadRequest(ctx, "response_payload should be of json type")
+			return
+		}
+	}
+	serviceID := serviceIDFromCtx(ctx)
+	apiID := fmt.Sprintf("%v", ctx.UserValue(APIID.String()))
+	var api *core.API
+	err = updateStore(ctx, func(tx *core.Tx) error {
+		service, err := tx.GetServiceByID(serviceID)
+		if err != nil {
+			return err
+		}
+		registered, err := service.GetAPIByID(apiID)
+		if err != nil {
+			return err
+		}
+		mockedResp := core.MockedResponse{ResponsePayload: respAsserted}
+		if req.ResponseCode != nil {
+			mockedResp.ResponseCode = *req.ResponseCode
+		}
+		if ctx.IsPatch() {
+			if req.ResponseCode == nil && registered.APIResponse != nil {
+				mockedResp.ResponseCode = registered.APIResponse.ResponseCode
+			}
+			if req.ResponsePayload == nil && registered.APIResponse != nil {
+				mockedResp.ResponsePayload = registered.APIResponse.ResponsePayload
+			}
+			if req.InvocationMode == nil {
+				req.InvocationMode = registered.InvocationMode
+			}
+		}
+		api, err = tx.UpdateAPI(serviceID, apiID, &mockedResp, req.InvocationMode)
+		return err
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	log.Info(fmt.Sprintf("API updated %v", api))
 	writeJSONResponse(ctx, api, nil)
 }
 
-func main() {
-	initLogger()
+func deleteService(ctx *fasthttp.RequestCtx) {
+	serviceID := serviceIDFromCtx(ctx)
+	var service *core.Service
+	err := updateStore(ctx, func(tx *core.Tx) error {
+		var err error
+		service, err = tx.GetServiceByID(serviceID)
+		if err != nil {
+			return err
+		}
+		tx.UnregisterService(serviceID)
+		return nil
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	pruneServiceRoutes()
+	log.Info(fmt.Sprintf("Service unregistered %v", service))
+	writeJSONResponse(ctx, service, nil)
+}
+
+func deleteAPI(ctx *fasthttp.RequestCtx) {
+	serviceID := serviceIDFromCtx(ctx)
+	apiID := fmt.Sprintf("%v", ctx.UserValue(APIID.String()))
+	var api *core.API
+	err := updateStore(ctx, func(tx *core.Tx) error {
+		var err error
+		api, err = tx.UnregisterAPI(serviceID, apiID)
+		return err
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	log.Info(fmt.Sprintf("API unregistered %v", api))
+	writeJSONResponse(ctx, api, nil)
+}
+
+// resetRegistry - Drops all the services and APIs of every namespace along with their routes, only the ones of the namespace
+// if reset through its prefix. Only the services matching the selector query param if given
+func resetRegistry(ctx *fasthttp.RequestCtx) {
+	selector, err := selectorFromCtx(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	if ctx.UserValue(NAMESPACE.String()) != nil {
+		removeServices(ctx, selector)
+		return
+	}
+	removed := 0
+	err = updateStore(ctx, func(tx *core.Tx) error {
+		removed = tx.Reset(selector)
+		return nil
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	pruneServiceRoutes()
+	log.Info(fmt.Sprintf("Registry reset, %v services removed", removed))
+	writeJSONResponse(ctx, map[string]interface{}{"services_removed": removed}, nil)
+}
+
+// deleteServices - Removes the services of the namespace matching the mandatory selector query param along with their APIs
+func deleteServices(ctx *fasthttp.RequestCtx) {
+	selector, err := selectorFromCtx(ctx)
+	if err == nil && len(selector) == 0 {
+		err = core.NewError(core.ErrInvalidArgument, "A selector is needed to delete services, use POST /v1/reset to remove all of them")
+	}
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	removeServices(ctx, selector)
+}
+
+func removeServices(ctx *fasthttp.RequestCtx, selector core.LabelSelector) {
+	namespace := namespaceFromCtx(ctx)
+	removed := 0
+	err := updateStore(ctx, func(tx *core.Tx) error {
+		removed = tx.ResetNamespace(namespace, selector)
+		return nil
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	pruneServiceRoutes()
+	log.Info(fmt.Sprintf("Namespace %q reset, %v services removed", namespace, removed))
+	writeJSONResponse(ctx, map[string]interface{}{"services_removed": removed}, nil)
+}
+
+// resetService - Drops all the APIs of the service, only the ones matching the selector query param if given.
+// The service itself stays registered
+func resetService(ctx *fasthttp.RequestCtx) {
+	selector, err := selectorFromCtx(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	removeAPIs(ctx, selector)
+}
+
+// deleteAPIs - Removes the APIs of the service matching the mandatory selector query param
+func deleteAPIs(ctx *fasthttp.RequestCtx) {
+	selector, err := selectorFromCtx(ctx)
+	if err == nil && len(selector) == 0 {
+		err = core.NewError(core.ErrInvalidArgument, "A selector is needed to delete APIs, use POST /v1/service/{serviceID}/reset to remove all of them")
+	}
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	removeAPIs(ctx, selector)
+}
+
+func removeAPIs(ctx *fasthttp.RequestCtx, selector core.LabelSelector) {
+	serviceID := serviceIDFromCtx(ctx)
+	removed := 0
+	err := updateStore(ctx, func(tx *core.Tx) error {
+		var err error
+		removed, err = tx.ResetService(serviceID, selector)
+		return err
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	pruneServiceRoutes()
+	log.Info(fmt.Sprintf("Service %v reset, %v APIs removed", serviceID, removed))
+	writeJSONResponse(ctx, map[string]interface{}{"apis_removed": removed}, nil)
+}
+
+func exportRegistry(ctx *fasthttp.RequestCtx) {
+	writeJSONResponse(ctx, store.Snapshot(), nil)
+}
+
+// Import modes supported by importRegistry
+const (
+	// mergeImport - Adds the bundle to what is registered, conflicting services/APIs fail the import
+	mergeImport = "merge"
+	// replaceImport - Drops everything registered and loads the bundle in its place
+	replaceImport = "replace"
+)
+
+// importRegistry - Loads a bundle exported by exportRegistry, all or nothing
+// POST /v1/import?mode=merge|replace (defaults to merge)
+func importRegistry(ctx *fasthttp.RequestCtx) {
+	mode := string(ctx.QueryArgs().Peek("mode"))
+	if mode == "" {
+		mode = mergeImport
+	}
+	if mode != mergeImport && mode != replaceImport {
+		handleBadRequest(ctx, fmt.Sprintf("Import mode %v not supported, use %v or %v", mode, mergeImport, replaceImport))
+		return
+	}
+	var bundle core.Snapshot
+	err := json.Unmarshal(ctx.Request.Body(), &bundle)
+	if err != nil {
+		handleBadRequest(ctx, "Unable to parse request payload")
+		return
+	}
+	for _, record := range bundle.Services {
+		registerServiceRoute(core.ServiceKey(record.Namespace, record.Name, record.Version))
+	}
+	err = updateStore(ctx, func(tx *core.Tx) error {
+		if mode == replaceImport {
+			return tx.Restore(&bundle)
+		}
+		return tx.Merge(&bundle)
+	})
+	if err != nil {
+		// Routes registered ahead for the services of a bundle that did not get imported
+		pruneServiceRoutes()
+		handleError(ctx, err)
+		return
+	}
+	if mode == replaceImport {
+		pruneServiceRoutes()
+	}
+	registerServiceRoutes(store.GetRegisteredServices())
+	log.Info(fmt.Sprintf("Imported %v services in %v mode", len(bundle.Services), mode))
+	writeJSONResponse(ctx, map[string]interface{}{"mode": mode, "services": len(bundle.Services)}, nil)
+}
+
+// getServiceRevisions - Revisions of the service, oldest first, available for removed services too
+func getServiceRevisions(ctx *fasthttp.RequestCtx) {
+	revisions, err := store.Revisions(serviceIDFromCtx(ctx), "")
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	writeJSONResponse(ctx, revisions, nil)
+}
+
+// getAPIRevisions - Revisions of the API, oldest first, available for removed APIs too
+func getAPIRevisions(ctx *fasthttp.RequestCtx) {
+	revisions, err := store.Revisions(serviceIDFromCtx(ctx), fmt.Sprintf("%v", ctx.UserValue(APIID.String())))
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	writeJSONResponse(ctx, revisions, nil)
+}
+
+// Rollback - Payload selecting the revision to roll back to
+/*
+ {
+  "revision":3
+ }
+*/
+type Rollback struct {
+	Revision int `json:"revision" validate:"required"`
+}
+
+// rollback - Rolls the service (or the API when apiID is not empty) back to the revision of the payload, atomically
+func rollback(ctx *fasthttp.RequestCtx, apiID string) {
+	var req Rollback
+	err := json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		handleBadRequest(ctx, "Unable to parse request payload")
+		return
+	}
+	err = validate.Struct(&req)
+	if err != nil {
+		handleValidationError(ctx, "Invalid rollback payload", err)
+		return
+	}
+	serviceID := serviceIDFromCtx(ctx)
+	if len(ctx.Request.Header.Peek(commentHeader)) == 0 {
+		ctx.Request.Header.Set(commentHeader, fmt.Sprintf("rollback to revision %v", req.Revision))
+	}
+	err = updateStore(ctx, func(tx *core.Tx) error {
+		if apiID == "" {
+			return tx.RollbackService(serviceID, req.Revision)
+		}
+		return tx.RollbackAPI(serviceID, apiID, req.Revision)
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	pruneServiceRoutes()
+	log.Info(fmt.Sprintf("Service %v API %q rolled back to revision %v", serviceID, apiID, req.Revision))
+	revisions, err := store.Revisions(serviceID, apiID)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	writeJSONResponse(ctx, revisions[len(revisions)-1], nil)
+}
+
+func rollbackService(ctx *fasthttp.RequestCtx) {
+	rollback(ctx, "")
+}
+
+func rollbackAPI(ctx *fasthttp.RequestCtx) {
+	rollback(ctx, fmt.Sprintf("%v", ctx.UserValue(APIID.String())))
+}
+
+// ProfileSwitch - Payload selecting the profile a service serves, an empty profile serves the untagged APIs only
+/*
+ {
+  "profile":"upstream-outage"
+ }
+*/
+type ProfileSwitch struct {
+	Profile string `json:"profile"`
+}
+
+// switchProfile - Switches the profile the mocks of the service are resolved against, nothing gets registered again
+func switchProfile(ctx *fasthttp.RequestCtx) {
+	var req ProfileSwitch
+	err := json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		handleBadRequest(ctx, "Unable to parse request payload")
+		return
+	}
+	serviceID := serviceIDFromCtx(ctx)
+	var service *core.Service
+	err = updateStore(ctx, func(tx *core.Tx) error {
+		var err error
+		service, err = tx.SetActiveProfile(serviceID, req.Profile)
+		return err
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	log.Info(fmt.Sprintf("Service %v switched to profile %q", serviceID, req.Profile))
+	writeJSONResponse(ctx, service, nil)
+}
+
+// getAllNamespaces - Namespaces in use along with how many services are registered within each
+func getAllNamespaces(ctx *fasthttp.RequestCtx) {
+	writeJSONResponse(ctx, core.GetNamespaces(store.GetRegisteredServices()), nil)
+}
+
+// deleteNamespace - Removes all the services of the namespace along with their APIs and routes
+func deleteNamespace(ctx *fasthttp.RequestCtx) {
+	namespace := namespaceFromCtx(ctx)
+	removed := 0
+	err := updateStore(ctx, func(tx *core.Tx) error {
+		removed = tx.ResetNamespace(namespace, nil)
+		if removed == 0 {
+			return core.NewError(core.ErrNotFound, "Namespace %v has no services registered", namespace)
+		}
+		return nil
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	pruneServiceRoutes()
+	log.Info(fmt.Sprintf("Namespace %v deleted, %v services removed", namespace, removed))
+	writeJSONResponse(ctx, map[string]interface{}{"services_removed": removed}, nil)
+}
+
+// newRouter - Router with all the moxy APIs, the per service mock routes are registered on it at runtime
+// Services, APIs and resets are served for the default namespace under /v1 and for any other namespace under /v1/ns/{namespace}
+func newRouter() *router.Router {
+	r := router.New()
 	r.Mutable(true)
+	r.NotFound = func(ctx *fasthttp.RequestCtx) {
+		handleNotFound(ctx, fmt.Sprintf("No route for %s %s", ctx.Method(), ctx.Path()))
+	}
 	r.GET("/v1", defaultHandler)
 	r.GET("/v1/health", defaultHandler)
 	r.GET("/v1/info", infoHandler)
-	// Core APIs
-	// Resource - Service
-	r.POST("/v1/service/register", serviceRegistration)
-	r.GET("/v1/service/{serviceID}", getService)
-	r.GET("/v1/service", getAllServices)
+	for _, prefix := range []string{"/v1", "/v1/ns/{namespace}"} {
+		// Core APIs
+		// Resource - Service
+		r.POST(prefix+"/service/register", serviceRegistration)
+		r.PUT(prefix+"/service/register", serviceRegistration)
+		r.GET(prefix+"/service/{serviceID}", getService)
+		r.GET(prefix+"/service", getAllServices)
+		r.DELETE(prefix+"/service", deleteServices)
+		r.PUT(prefix+"/service/{serviceID}", updateService)
+		r.PATCH(prefix+"/service/{serviceID}", updateService)
+		r.DELETE(prefix+"/service/{serviceID}", deleteService)
+
+		// Resource - API a.k.a Mocked API
+		r.POST(prefix+"/service/{serviceID}/api/register", apiRegistration)
+		r.PUT(prefix+"/service/{serviceID}/api/register", apiRegistration)
+		r.POST(prefix+"/service/{serviceID}/api/bulk", apiBulkRegistration)
+		r.GET(prefix+"/service/{serviceID}/api", getAllAPIs)
+		r.DELETE(prefix+"/service/{serviceID}/api", deleteAPIs)
+		r.GET(prefix+"/services/{serviceID}/api/{apiID}", getAPI)
+		r.PUT(prefix+"/service/{serviceID}/api/{apiID}", updateAPI)
+		r.PATCH(prefix+"/service/{serviceID}/api/{apiID}", updateAPI)
+		r.DELETE(prefix+"/service/{serviceID}/api/{apiID}", deleteAPI)
+
+		// Resource - Profile
+		r.POST(prefix+"/service/{serviceID}/profile", switchProfile)
 
-	// Resource - API a.k.a Mocked API
-	r.POST("/v1/service/{serviceID}/api/register", apiRegistration)
-	r.GET("/v1/service/{serviceID}/api", getAllAPIs)
-	r.GET("/v1/services/{serviceID}/api/{apiID}", getAPI)
+		// Resource - Revision history
+		r.GET(prefix+"/service/{serviceID}/revisions", getServiceRevisions)
+		r.POST(prefix+"/service/{serviceID}/rollback", rollbackService)
+		r.GET(prefix+"/service/{serviceID}/api/{apiID}/revisions", getAPIRevisions)
+		r.POST(prefix+"/service/{serviceID}/api/{apiID}/rollback", rollbackAPI)
 
+		// Resource - Runtime state
+		r.POST(prefix+"/reset", resetRegistry)
+		r.POST(prefix+"/service/{serviceID}/reset", resetService)
+	}
+
+	// Resource - Namespace
+	r.GET("/v1/ns", getAllNamespaces)
+	r.DELETE("/v1/ns/{namespace}", deleteNamespace)
+
+	// Resource - Whole registry bundle
+	r.GET("/v1/export", exportRegistry)
+	r.POST("/v1/import", importRegistry)
+
+	// Resource - Change events
+	r.GET("/v1/events", streamEvents)
+	return r
+}
+
+// serverIdleTimeout - How long a keep-alive connection waits for its next request, bounds how long a shutdown waits for them
+const serverIdleTimeout = 10 * time.Second
+
+func main() {
+	initLogger()
+	flag.Parse()
+	if args.snapshotFile != "" && args.storeType == core.FileStoreType {
+		// Both would persist and restore the registry, each overwriting what the other one loaded
+		log.Fatal(fmt.Sprintf("-snapshot-file can not be used along with -store=%v, the file store persists every change already", core.FileStoreType))
+	}
+	r = newRouter()
+	var err error
+	store, err = core.NewStore(args.storeType, args.storeFile)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Unable to initialise %v store :: %v", args.storeType, err.Error()))
+	}
+	var snapshots *snapshotWriter
+	if args.snapshotFile != "" {
+		if err := restoreSnapshot(args.snapshotFile); err != nil {
+			log.Fatal(fmt.Sprintf("Unable to restore snapshot :: %v", err.Error()))
+		}
+		snapshots = startSnapshotWriter(args.snapshotFile)
+	}
+	if args.mocksDir != "" {
+		mocksDir := newMocksDirWatcher(args.mocksDir, args.mocksPoll)
+		if err := mocksDir.load(); err != nil {
+			log.Fatal(fmt.Sprintf("Unable to load mocks directory :: %v", err.Error()))
+		}
+		if args.mocksPoll > 0 {
+			go mocksDir.watch()
+		}
+	}
+	registerServiceRoutes(store.GetRegisteredServices())
+	if args.reapEvery > 0 {
+		go reapExpired(args.reapEvery)
+	}
+
+	// Idle keep-alive connections are only dropped by Shutdown once they time out
+	server := &fasthttp.Server{Handler: routesHandler, IdleTimeout: serverIdleTimeout}
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	// stopped - Closed once the in-flight requests are done, ListenAndServe returns as soon as the listener is closed
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		sig := <-shutdown
+		log.Info(fmt.Sprintf("Received %v, shutting down", sig))
+		// Event streams never go idle on their own
+		close(closingEventStreams)
+		if err := server.Shutdown(); err != nil {
+			log.Error(fmt.Sprintf("Error shutting down server :: %v", err.Error()))
+		}
+	}()
 	log.Info("Server Started, listening on port 8080")
-	log.Fatal(fasthttp.ListenAndServe(":8080", r.Handler))
+	if err := server.ListenAndServe(":8080"); err != nil {
+		log.Fatal(err)
+	}
+	<-stopped
+	if snapshots != nil {
+		snapshots.close()
+	}
 }
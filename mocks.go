@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/heckdevice/moxy/core"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MockDefinition - A service along with its APIs as declared in a file of the mocks directory
+/*
+ {
+  "name":"google",
+  "version":"1.0",
+  "apis":[
+   {
+    "api_url":"/v1/helloworld",
+    "method":"GET",
+    "request_payload":{},
+    "response_payload":{},
+    "response_code":200
+   }
+  ]
+ }
+*/
+type MockDefinition struct {
+	Name           string            `json:"name" validate:"required"`
+	Version        string            `json:"version" validate:"required"`
+	Namespace      string            `json:"namespace,omitempty"`
+	BaseURL        *string           `json:"base_url,omitempty"`
+	InvocationMode *string           `json:"invocation_mode,omitempty"`
+	ActiveProfile  string            `json:"active_profile,omitempty"`
+	Labels         core.Labels       `json:"labels,omitempty"`
+	APIs           []MockableRequest `json:"apis" validate:"dive"`
+}
+
+// mockFile - A parsed mock definition along with the file it was loaded from
+type mockFile struct {
+	path       string
+	definition *MockDefinition
+}
+
+// mockFileExtensions - Supported mock definition file extensions, YAML files use the same field names as JSON
+var mockFileExtensions = map[string]bool{
+	".json": true,
+	".yaml": true,
+	".yml":  true,
+}
+
+// readMockDefinitions - Parses and validates all the mock definition files of the directory, sorted by file name
+func readMockDefinitions(dir string) ([]mockFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read mocks directory %v :: %v", dir, err.Error())
+	}
+	files := make([]mockFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !mockFileExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		definition, err := readMockDefinition(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err.Error())
+		}
+		files = append(files, mockFile{path, definition})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+// readMockDefinition - Parses and validates a single mock definition file
+func readMockDefinition(path string) (*MockDefinition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		// YAML is normalised to JSON so that both formats share the json field names and decoding rules
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		data, err = json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var definition MockDefinition
+	if err := json.Unmarshal(data, &definition); err != nil {
+		if typeErr, OK := err.(*json.UnmarshalTypeError); OK {
+			return nil, fmt.Errorf("field %v: expected %v but got %v", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return nil, err
+	}
+	if err := validate.Struct(&definition); err != nil {
+		if fieldErrs, OK := err.(validator.ValidationErrors); OK && len(fieldErrs) > 0 {
+			fieldErr := fieldErrs[0]
+			field := strings.TrimPrefix(fieldErr.Namespace(), "MockDefinition.")
+			return nil, fmt.Errorf("field %v: failed on the '%v' validation", field, fieldErr.Tag())
+		}
+		return nil, err
+	}
+	for i := range definition.APIs {
+		if _, _, _, err := definition.APIs[i].resolve(); err != nil {
+			return nil, fmt.Errorf("field apis[%d]: %v", i, err.Error())
+		}
+	}
+	return &definition, nil
+}
+
+// registerMockDefinition - Registers the service and its APIs within the transaction, replacing the service if already registered
+func registerMockDefinition(tx *core.Tx, file mockFile) error {
+	definition := file.definition
+	service, err := tx.RegisterService(definition.Namespace, definition.Name, definition.Version, definition.BaseURL, definition.InvocationMode)
+	if err != nil {
+		return fmt.Errorf("%v: service %v.%v: %v", file.path, definition.Name, definition.Version, err.Error())
+	}
+	if err := tx.SetServiceLabels(service.ID, definition.Labels); err != nil {
+		return fmt.Errorf("%v: field labels: %v", file.path, err.Error())
+	}
+	if _, err := tx.SetActiveProfile(service.ID, definition.ActiveProfile); err != nil {
+		return fmt.Errorf("%v: field active_profile: %v", file.path, err.Error())
+	}
+	for i := range definition.APIs {
+		req := &definition.APIs[i]
+		verb, reqAsserted, mockedResp, err := req.resolve()
+		if err == nil {
+			var api *core.API
+			api, err = tx.RegisterProfileAPI(service.ID, req.Profile, req.APIURL, req.Matchers, verb, reqAsserted, mockedResp, req.InvocationMode)
+			if err == nil {
+				var expiresAt *time.Time
+				expiresAt, err = resolveExpiry(req.TTL, req.ExpiresAt)
+				if err == nil {
+					err = req.configure(tx, service.ID, api.ID, expiresAt)
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%v: field apis[%d]: %v", file.path, i, err.Error())
+		}
+	}
+	return nil
+}
+
+// mocksDirWatcher - Keeps the store in sync with the mock definition files of a directory
+type mocksDirWatcher struct {
+	dir      string
+	interval time.Duration
+	// fingerprint - Names, sizes and modification times of the files last loaded
+	fingerprint string
+	// loaded - Definitions last registered from the directory, by service key
+	loaded map[string]*MockDefinition
+}
+
+func newMocksDirWatcher(dir string, interval time.Duration) *mocksDirWatcher {
+	return &mocksDirWatcher{dir: dir, interval: interval, loaded: make(map[string]*MockDefinition)}
+}
+
+// dirFingerprint - Cheap summary of the mock definition files of the directory, changes whenever one of them does
+func (w *mocksDirWatcher) dirFingerprint() (string, error) {
+	entries, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return "", err
+	}
+	var fingerprint strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || !mockFileExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+		fmt.Fprintf(&fingerprint, "%v:%v:%v;", entry.Name(), entry.Size(), entry.ModTime().UnixNano())
+	}
+	return fingerprint.String(), nil
+}
+
+// load - Diffs the definitions of the directory against the ones last loaded and applies the difference in one transaction,
+// services no longer declared are removed, new or changed ones are (re)registered. All or nothing, the store is untouched if it errs
+// Services declared in the directory replace the ones already registered with the same name and version
+func (w *mocksDirWatcher) load() error {
+	fingerprint, err := w.dirFingerprint()
+	if err != nil {
+		return fmt.Errorf("Unable to read mocks directory %v :: %v", w.dir, err.Error())
+	}
+	files, err := readMockDefinitions(w.dir)
+	if err != nil {
+		return err
+	}
+	declared := make(map[string]mockFile, len(files))
+	for _, file := range files {
+		serviceKey := core.ServiceKey(file.definition.Namespace, file.definition.Name, file.definition.Version)
+		if previous, OK := declared[serviceKey]; OK {
+			return fmt.Errorf("%v: service %v already declared in %v", file.path, serviceKey, previous.path)
+		}
+		declared[serviceKey] = file
+	}
+	// Routes are in place before the services get published, they only serve once the services are in the store
+	for serviceKey := range declared {
+		registerServiceRoute(serviceKey)
+	}
+	added, updated, removed := 0, 0, 0
+	err = store.Update(func(tx *core.Tx) error {
+		tx.Annotate("", fmt.Sprintf("loaded from mocks directory %v", w.dir))
+		for serviceKey := range w.loaded {
+			if _, OK := declared[serviceKey]; !OK && tx.UnregisterService(serviceKey) {
+				removed++
+			}
+		}
+		for _, file := range files {
+			serviceKey := core.ServiceKey(file.definition.Namespace, file.definition.Name, file.definition.Version)
+			_, err := tx.GetServiceByID(serviceKey)
+			registered := err == nil
+			if previous, OK := w.loaded[serviceKey]; OK && registered && reflect.DeepEqual(previous, file.definition) {
+				continue
+			}
+			tx.UnregisterService(serviceKey)
+			if err := registerMockDefinition(tx, file); err != nil {
+				return err
+			}
+			if registered {
+				updated++
+			} else {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Routes registered ahead for the services of definitions that did not get loaded
+		pruneServiceRoutes()
+		return err
+	}
+	if removed > 0 {
+		pruneServiceRoutes()
+	}
+	// Registered again in case the routes got pruned while the change was being applied
+	for serviceKey := range declared {
+		registerServiceRoute(serviceKey)
+	}
+	w.fingerprint = fingerprint
+	w.loaded = make(map[string]*MockDefinition, len(declared))
+	for serviceKey, file := range declared {
+		w.loaded[serviceKey] = file.definition
+	}
+	log.Info(fmt.Sprintf("Loaded mock definitions from %v :: added=%v, updated=%v, removed=%v", w.dir, added, updated, removed))
+	return nil
+}
+
+// watch - Polls the directory and reloads it whenever its files change, a failing reload is logged and leaves the store as it was
+func (w *mocksDirWatcher) watch() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		fingerprint, err := w.dirFingerprint()
+		if err != nil {
+			log.Error(fmt.Sprintf("Unable to read mocks directory %v :: %v", w.dir, err.Error()))
+			continue
+		}
+		if fingerprint == w.fingerprint {
+			continue
+		}
+		if err := w.load(); err != nil {
+			log.Error(fmt.Sprintf("Unable to reload mocks directory, keeping the previous mocks :: %v", err.Error()))
+			// Do not retry the same broken content on every tick
+			w.fingerprint = fingerprint
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"github.com/heckdevice/moxy/core"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// reapExpired - Removes the services and APIs whose time to live elapsed, every interval,
+// along with the routes of the services no longer serving
+func reapExpired(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		services, apis := 0, 0
+		err := store.Update(func(tx *core.Tx) error {
+			tx.Annotate("", "time to live elapsed")
+			services, apis = tx.Expire(time.Now())
+			return nil
+		})
+		if err != nil {
+			log.Error(fmt.Sprintf("Unable to remove expired mocks :: %v", err.Error()))
+			continue
+		}
+		if services == 0 && apis == 0 {
+			continue
+		}
+		pruneServiceRoutes()
+		log.Info(fmt.Sprintf("Expired mocks removed :: services=%v, apis=%v", services, apis))
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fasthttp/router"
+	"github.com/heckdevice/moxy/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"strings"
+	"sync"
+)
+
+// Per service catch-all routes are registered on the mutable router while it is serving,
+// the router tree is not safe for that hence lookups and route registrations are guarded by routesLock.
+// A route left in the tree serves only as long as the registry says so (see isServiceRouted), so removing a service
+// from the store tears its route down atomically with it. The stale routes are dropped later on by pruneServiceRoutes.
+var (
+	routesLock     sync.RWMutex
+	servicesRouted = make(map[string]bool)
+)
+
+// routesHandler - Router handler safe against routes being registered concurrently
+func routesHandler(ctx *fasthttp.RequestCtx) {
+	routeToNamespace(ctx)
+	routesLock.RLock()
+	handler, _ := r.Lookup(string(ctx.Method()), string(ctx.Path()), ctx)
+	routesLock.RUnlock()
+	if handler != nil {
+		handler(ctx)
+		return
+	}
+	// Not found, redirects and method not allowed are left to the router, none of these register routes
+	routesLock.RLock()
+	defer routesLock.RUnlock()
+	r.Handler(ctx)
+}
+
+// routeToNamespace - Serves a mock request carrying the namespace header from the mocks of that namespace,
+// i.e. /{serviceID}/... is served as /ns/{namespace}/{serviceID}/...
+func routeToNamespace(ctx *fasthttp.RequestCtx) {
+	namespace := string(ctx.Request.Header.Peek(namespaceHeader))
+	if namespace == core.DefaultNamespace {
+		return
+	}
+	path := string(ctx.Path())
+	if strings.HasPrefix(path, "/v1/") || path == "/v1" || strings.HasPrefix(path, namespaceIDPrefix) {
+		return
+	}
+	ctx.Request.SetRequestURI(namespaceIDPrefix + namespace + string(ctx.RequestURI()))
+}
+
+// registerServiceRoute - Registers the catch-all route serving the mocks of the service, once per service id
+func registerServiceRoute(serviceID string) {
+	routesLock.Lock()
+	defer routesLock.Unlock()
+	if servicesRouted[serviceID] {
+		return
+	}
+	if addServiceRoute(r, serviceID) {
+		servicesRouted[serviceID] = true
+	}
+}
+
+func serviceRoutePath(serviceID string) string {
+	return fmt.Sprintf("/%s/{mockedPath:*}", serviceID)
+}
+
+// addServiceRoute - Adds the catch-all route of the service to the router, reports false if the router rejected it.
+// The router panics on paths it can not parse, one such service is left unrouted instead of taking the others down
+func addServiceRoute(serviceRouter *router.Router, serviceID string) (added bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error(fmt.Sprintf("Unable to route service %v :: %v", serviceID, err))
+			added = false
+		}
+	}()
+	serviceRouter.ANY(serviceRoutePath(serviceID), bigFatHandler)
+	return true
+}
+
+// isServiceRouted - Checks if the catch-all route of the service is to serve requests,
+// i.e. the service proxies or has at least one API registered
+func isServiceRouted(service *core.Service) bool {
+	return service.IsPassThroughAllowed() || service.RoutesRegistered() > 0
+}
+
+// registerServiceRoutes - Registers the routes for the services that are to serve, e.g. the ones already in the store at startup
+func registerServiceRoutes(services map[string]*core.Service) {
+	for _, service := range services {
+		if isServiceRouted(service) {
+			registerServiceRoute(service.ID)
+		}
+	}
+}
+
+// pruneServiceRoutes - Rebuilds the router with the routes of the services still serving only,
+// the router has no way to remove a route hence the dropped ones go away along with the previous router
+func pruneServiceRoutes() {
+	routesLock.Lock()
+	defer routesLock.Unlock()
+	pruned := newRouter()
+	routed := make(map[string]bool)
+	for _, service := range store.GetRegisteredServices() {
+		if isServiceRouted(service) && addServiceRoute(pruned, service.ID) {
+			routed[service.ID] = true
+		}
+	}
+	r = pruned
+	servicesRouted = routed
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"github.com/heckdevice/moxy/core"
+	log "github.com/sirupsen/logrus"
+)
+
+// snapshotWriter - Keeps the snapshot file in sync with the store, rewriting it in the background after every change
+type snapshotWriter struct {
+	path    string
+	changed chan struct{}
+	done    chan struct{}
+	unwatch func()
+}
+
+// restoreSnapshot - Loads the snapshot file (if present) into the store
+func restoreSnapshot(path string) error {
+	snapshot, err := core.LoadSnapshot(path)
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		log.Info(fmt.Sprintf("No snapshot found at %v, starting empty", path))
+		return nil
+	}
+	if err := store.Restore(snapshot); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("Restored %v services from snapshot %v taken at %v", len(snapshot.Services), path, snapshot.CreatedAt))
+	return nil
+}
+
+func startSnapshotWriter(path string) *snapshotWriter {
+	writer := &snapshotWriter{path, make(chan struct{}, 1), make(chan struct{}), nil}
+	writer.unwatch = store.Watch(func(event core.StoreEvent) {
+		// Changes arriving while a write is pending are coalesced into it
+		select {
+		case writer.changed <- struct{}{}:
+		default:
+		}
+	})
+	go writer.run()
+	return writer
+}
+
+func (w *snapshotWriter) run() {
+	defer close(w.done)
+	for range w.changed {
+		w.write()
+	}
+}
+
+func (w *snapshotWriter) write() {
+	if err := core.SaveSnapshot(w.path, store.Snapshot()); err != nil {
+		log.Error(fmt.Sprintf("Unable to write snapshot %v :: %v", w.path, err.Error()))
+	}
+}
+
+// close - Stops watching the store and writes the final snapshot
+func (w *snapshotWriter) close() {
+	w.unwatch()
+	close(w.changed)
+	<-w.done
+	w.write()
+	log.Info(fmt.Sprintf("Snapshot written to %v", w.path))
+}